@@ -0,0 +1,452 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// An appeal is stored under (appeal, item, reporter), so every member files at most one appeal per item
+const appealObjectType = "appeal"
+
+// Reasons a member can give when appealing a post or comment
+const (
+	AppealReasonSpam           = "spam"
+	AppealReasonHarassment     = "harassment"
+	AppealReasonHate           = "hate"
+	AppealReasonMisinformation = "misinformation"
+	AppealReasonOffTopic       = "offTopic"
+	AppealReasonRuleViolation  = "ruleViolation"
+	AppealReasonOther          = "other"
+)
+
+var appealReasons = []string{
+	AppealReasonSpam,
+	AppealReasonHarassment,
+	AppealReasonHate,
+	AppealReasonMisinformation,
+	AppealReasonOffTopic,
+	AppealReasonRuleViolation,
+	AppealReasonOther,
+}
+
+const (
+	DefaultAppealThreshold = 1 //distinct members who must appeal before an item reaches the moderators
+	MaxAppealDetailsLength = 500
+)
+
+type Appeal struct {
+	ItemId      string    `json:"itemId"`
+	ItemType    string    `json:"itemType"`
+	CommunityId string    `json:"communityId"`
+	Reporter    string    `json:"reporter"`
+	Reason      string    `json:"reason"`
+	Details     string    `json:"details"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+/*
+The appeals filed against an item. Reasons counts the appeals per reason; the individual appeals,
+which name their reporters, are only included for moderators.
+*/
+type AppealSummary struct {
+	Count     int            `json:"count"`
+	Threshold int            `json:"threshold"`
+	Reasons   map[string]int `json:"reasons"`
+	Appeals   []*Appeal      `json:"appeals,omitempty" metadata:",optional"`
+}
+
+type AppealedItem struct {
+	Post    *PostModified
+	Comment *CommentModified
+	Case    *ModerationCase `json:"case"`
+	Appeals AppealSummary   `json:"appeals"`
+}
+
+type AppealedPage struct {
+	Items      []*AppealedItem `json:"items"`
+	NextCursor string          `json:"nextCursor"` //empty on the last page
+}
+
+type AppealEventPayload struct {
+	ItemId      string `json:"itemId"`
+	ItemType    string `json:"itemType"`
+	CommunityId string `json:"communityId"`
+	UserId      string `json:"userId"`
+	Reason      string `json:"reason,omitempty"`
+	CaseId      string `json:"caseId,omitempty"` //open case of the item, if any
+	Appeals     int    `json:"appeals"`          //appeals filed against the item after this transaction
+	Queued      bool   `json:"queued"`           //whether the item has an open case after this transaction
+}
+
+type AppealThresholdEventPayload struct {
+	CommunityId string `json:"communityId"`
+	UserId      string `json:"userId"`
+	Threshold   int    `json:"threshold"`
+}
+
+func appealThreshold(community *Community) int {
+	if community.AppealThreshold <= 0 {
+		return DefaultAppealThreshold
+	}
+	return community.AppealThreshold
+}
+
+func appealKey(ctx contractapi.TransactionContextInterface, itemId string, reporter string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(appealObjectType, []string{itemId, reporter})
+}
+
+func (s *SmartContract) getAppeal(ctx contractapi.TransactionContextInterface, itemId string, reporter string) (*Appeal, error) {
+	key, err := appealKey(ctx, itemId, reporter)
+	if err != nil {
+		return nil, err
+	}
+	appealJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read appeal from ledger: %w", err)
+	}
+	if appealJson == nil {
+		return nil, nil
+	}
+	var appeal Appeal
+	err = json.Unmarshal(appealJson, &appeal)
+	if err != nil {
+		return nil, err
+	}
+	return &appeal, nil
+}
+
+/*
+Returns the appeals filed against an item, ordered by reporter Id.
+*/
+func (s *SmartContract) itemAppeals(ctx contractapi.TransactionContextInterface, itemId string) ([]*Appeal, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(appealObjectType, []string{itemId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+	appeals := make([]*Appeal, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var appeal Appeal
+		err = json.Unmarshal(queryResponse.Value, &appeal)
+		if err != nil {
+			return nil, err
+		}
+		appeals = append(appeals, &appeal)
+	}
+	return appeals, nil
+}
+
+/*
+Removes every appeal filed against an item, once moderators have decided it.
+*/
+func (s *SmartContract) clearAppeals(ctx contractapi.TransactionContextInterface, itemId string) error {
+	appeals, err := s.itemAppeals(ctx, itemId)
+	if err != nil {
+		return err
+	}
+	for _, appeal := range appeals {
+		key, err := appealKey(ctx, itemId, appeal.Reporter)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func summarizeAppeals(appeals []*Appeal, threshold int, withReporters bool) AppealSummary {
+	summary := AppealSummary{
+		Count:     len(appeals),
+		Threshold: threshold,
+		Reasons:   make(map[string]int),
+	}
+	for _, appeal := range appeals {
+		summary.Reasons[appeal.Reason]++
+	}
+	if withReporters {
+		summary.Appeals = appeals
+	}
+	return summary
+}
+
+/*
+Returns the type of an appealable item, its community and whether it is hidden.
+*/
+func (s *SmartContract) appealTarget(ctx contractapi.TransactionContextInterface, itemId string) (string, string, bool, error) {
+	itemType, err := s.getItemType(ctx, itemId)
+	if err != nil {
+		return "", "", false, err
+	}
+	if itemType == postObjectType {
+		existingPost, err := s.GetPost(ctx, itemId)
+		if err != nil {
+			return "", "", false, err
+		}
+		if existingPost == nil {
+			return "", "", false, fmt.Errorf("Post with ID %s doesn't exists", itemId)
+		}
+		return itemType, existingPost.Community, existingPost.Hidden, nil
+	}
+	existingComment, err := s.GetComment(ctx, itemId)
+	if err != nil {
+		return "", "", false, err
+	}
+	if existingComment == nil {
+		return "", "", false, fmt.Errorf("Comment with ID %s doesn't exists", itemId)
+	}
+	return itemType, existingComment.Community, existingComment.Hidden, nil
+}
+
+/*
+Allows members to appeal a post or comment within a community, giving one of the appeal reasons and optional details.
+It takes post Id or comment Id, the reason, the details and user Id as parameters.
+Each member can appeal an item once. A moderation case is opened, putting the item in the moderators' queue, once the community's
+appeal threshold of distinct members have appealed it; later appeals are added to the open case.
+Returns the item's open case, or nil while the item has too few appeals.
+*/
+func (s *SmartContract) AppealPost(ctx contractapi.TransactionContextInterface, postId string, reason string, details string, userId string) (*ModerationCase, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	itemType, communityId, hidden, err := s.appealTarget(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	if hidden {
+		return nil, fmt.Errorf("Item with ID %s is hidden and cannot be appealed", postId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkNotBanned(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(existingCommunity.Users, userId) {
+		return nil, fmt.Errorf("User cannot appeal as you are not part of the community")
+	}
+	if !contains(appealReasons, reason) {
+		return nil, fmt.Errorf("Invalid appeal reason %s", reason)
+	}
+	if len(details) > MaxAppealDetailsLength {
+		return nil, fmt.Errorf("Appeal details can't be longer than %d characters", MaxAppealDetailsLength)
+	}
+	existingAppeal, err := s.getAppeal(ctx, postId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existingAppeal != nil {
+		return nil, fmt.Errorf("User already appealed")
+	}
+	// Range queries don't see this transaction's own writes, so the appeals are counted before the new one is stored
+	appeals, err := s.itemAppeals(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appeal := Appeal{
+		ItemId:      postId,
+		ItemType:    itemType,
+		CommunityId: communityId,
+		Reporter:    userId,
+		Reason:      reason,
+		Details:     details,
+		CreatedAt:   currentTime,
+	}
+	key, err := appealKey(ctx, postId, userId)
+	if err != nil {
+		return nil, err
+	}
+	appealJson, _ := json.Marshal(appeal)
+	err = ctx.GetStub().PutState(key, appealJson)
+	if err != nil {
+		return nil, err
+	}
+	moderationCase, err := s.openItemCase(ctx, postId, itemType)
+	if err != nil {
+		return nil, err
+	}
+	payload := AppealEventPayload{ItemId: postId, ItemType: itemType, CommunityId: communityId, UserId: userId, Reason: reason, Appeals: len(appeals) + 1}
+	if moderationCase != nil || len(appeals)+1 < appealThreshold(existingCommunity) {
+		payload.Queued = moderationCase != nil
+		if moderationCase != nil {
+			payload.CaseId = moderationCase.ID
+		}
+		err = emitEvent(ctx, AppealFiledEvent, payload)
+		if err != nil {
+			return nil, err
+		}
+		return moderationCase, nil
+	}
+	moderationCase, err = s.openCase(ctx, existingCommunity, postId, itemType)
+	if err != nil {
+		return nil, err
+	}
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	payload.Queued = true
+	payload.CaseId = moderationCase.ID
+	err = emitEvent(ctx, ContentAppealedEvent, payload)
+	if err != nil {
+		return nil, err
+	}
+	return moderationCase, nil
+}
+
+/*
+Withdraws the user's appeal of a post or comment. A case that is already open stays open
+until the moderators decide it or it expires.
+*/
+func (s *SmartContract) UnAppealPost(ctx contractapi.TransactionContextInterface, postId string, userId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	itemType, communityId, _, err := s.appealTarget(ctx, postId)
+	if err != nil {
+		return err
+	}
+	existingAppeal, err := s.getAppeal(ctx, postId, userId)
+	if err != nil {
+		return err
+	}
+	if existingAppeal == nil {
+		return fmt.Errorf("User cannot unappeal the post")
+	}
+	appeals, err := s.itemAppeals(ctx, postId)
+	if err != nil {
+		return err
+	}
+	key, err := appealKey(ctx, postId, userId)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return err
+	}
+	moderationCase, err := s.openItemCase(ctx, postId, itemType)
+	if err != nil {
+		return err
+	}
+	payload := AppealEventPayload{ItemId: postId, ItemType: itemType, CommunityId: communityId, UserId: userId, Appeals: len(appeals) - 1, Queued: moderationCase != nil}
+	if moderationCase != nil {
+		payload.CaseId = moderationCase.ID
+	}
+	return emitEvent(ctx, AppealWithdrawnEvent, payload)
+}
+
+/*
+Sets how many distinct members must appeal an item before it enters the moderators' queue. Only moderators of the community can change it.
+Items already in the queue stay there, and items that meet a lowered threshold are queued on their next appeal.
+*/
+func (s *SmartContract) SetAppealThreshold(ctx contractapi.TransactionContextInterface, communityId string, threshold int, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	if threshold < 1 {
+		return fmt.Errorf("Appeal threshold must be at least 1")
+	}
+	existingCommunity.AppealThreshold = threshold
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	return emitEvent(ctx, AppealThresholdChangedEvent, AppealThresholdEventPayload{CommunityId: communityId, UserId: userId, Threshold: threshold})
+}
+
+func validCaseState(state string) bool {
+	return state == CaseOpen || state == CaseHidden || state == CaseUpheld || state == CaseExpired
+}
+
+/*
+Returns a page of a community's moderation cases in the given state, newest first, with their posts or comments
+and the appeals filed against them. An empty state lists the open cases, which make up the moderators' queue.
+Every reader sees how many appeals each reason got; moderators also see the individual appeals of open cases and their reporters.
+*/
+func (s *SmartContract) GetCommunityAppealed(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string, state string) (*AppealedPage, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	if state == "" {
+		state = CaseOpen
+	}
+	if !validCaseState(state) {
+		return nil, fmt.Errorf("Invalid case state %s", state)
+	}
+	isModerator := contains(existingCommunity.Moderators, userId) && authorizeCaller(ctx, userId) == nil
+	cases := make(map[string]*ModerationCase)
+	entries, err := scanIndexes(ctx, caseIndex, []string{communityId}, cursor, PostsPerPage+1, func(caseId string) (bool, error) {
+		moderationCase, err := s.getCase(ctx, caseId)
+		if err != nil || moderationCase == nil || moderationCase.State != state {
+			return false, err
+		}
+		cases[caseId] = moderationCase
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, PostsPerPage)
+	page := AppealedPage{
+		Items:      make([]*AppealedItem, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		moderationCase := cases[entry.itemId]
+		item := AppealedItem{Case: moderationCase}
+		if moderationCase.ItemType == postObjectType {
+			existingPost, err := s.GetPost(ctx, moderationCase.ItemId)
+			if err != nil {
+				return nil, err
+			}
+			item.Post, err = s.convertToPostModified(ctx, existingPost, userId)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			existingComment, err := s.GetComment(ctx, moderationCase.ItemId)
+			if err != nil {
+				return nil, err
+			}
+			item.Comment, err = s.convertToCommentModified(ctx, existingComment, userId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if moderationCase.Decision != nil {
+			item.Appeals = AppealSummary{
+				Count:     moderationCase.Decision.Appeals,
+				Threshold: appealThreshold(existingCommunity),
+				Reasons:   moderationCase.Decision.Reasons,
+			}
+		} else {
+			appeals, err := s.itemAppeals(ctx, moderationCase.ItemId)
+			if err != nil {
+				return nil, err
+			}
+			item.Appeals = summarizeAppeals(appeals, appealThreshold(existingCommunity), isModerator)
+		}
+		page.Items = append(page.Items, &item)
+	}
+	return &page, nil
+}
@@ -0,0 +1,311 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A ban is stored under (ban, community, user) and in the community's time-ordered ban list
+const (
+	banObjectType = "ban"
+	banIndex      = "banIndex"
+)
+
+const (
+	BansPerPage        = 20
+	MaxBanReasonLength = 500
+)
+
+/*
+Bars a user from posting, commenting, voting, appealing and joining in a community.
+A zero ExpiresAt is a permanent ban; otherwise the ban lapses on its own once the time has passed.
+*/
+type Ban struct {
+	CommunityId string    `json:"communityId"`
+	UserId      string    `json:"userId"`
+	BannedBy    string    `json:"bannedBy"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type BanPage struct {
+	Bans       []*Ban `json:"bans"`
+	NextCursor string `json:"nextCursor"` //empty on the last page
+}
+
+type BanEventPayload struct {
+	CommunityId string    `json:"communityId"`
+	UserId      string    `json:"userId"`
+	Moderator   string    `json:"moderator"`
+	Reason      string    `json:"reason,omitempty"`
+	ExpiresAt   time.Time `json:"expiresAt"` //zero for a permanent ban
+}
+
+func banKey(ctx contractapi.TransactionContextInterface, communityId string, userId string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(banObjectType, []string{communityId, userId})
+}
+
+func (s *SmartContract) getBan(ctx contractapi.TransactionContextInterface, communityId string, userId string) (*Ban, error) {
+	key, err := banKey(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	banJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ban from ledger: %w", err)
+	}
+	if banJson == nil {
+		return nil, nil
+	}
+	var ban Ban
+	err = json.Unmarshal(banJson, &ban)
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func deleteBan(ctx contractapi.TransactionContextInterface, ban *Ban) error {
+	key, err := banKey(ctx, ban.CommunityId, ban.UserId)
+	if err != nil {
+		return err
+	}
+	indexKey, err := ctx.GetStub().CreateCompositeKey(banIndex, []string{ban.CommunityId, indexSortKey(ban.CreatedAt), ban.UserId})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(indexKey)
+}
+
+/*
+Returns the user's ban from a community if it is still in force, nil otherwise.
+Expired bans are left on the ledger until a moderator lifts them or bans the user again.
+*/
+func (s *SmartContract) activeBan(ctx contractapi.TransactionContextInterface, communityId string, userId string) (*Ban, error) {
+	ban, err := s.getBan(ctx, communityId, userId)
+	if err != nil || ban == nil {
+		return nil, err
+	}
+	if ban.ExpiresAt.IsZero() {
+		return ban, nil
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !currentTime.Before(ban.ExpiresAt) {
+		return nil, nil
+	}
+	return ban, nil
+}
+
+/*
+Fails if the user is banned from the community.
+*/
+func (s *SmartContract) checkNotBanned(ctx contractapi.TransactionContextInterface, communityId string, userId string) error {
+	ban, err := s.activeBan(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	if ban == nil {
+		return nil
+	}
+	if ban.ExpiresAt.IsZero() {
+		return fmt.Errorf("User with ID %s is banned from community %s", userId, communityId)
+	}
+	return fmt.Errorf("User with ID %s is banned from community %s until %s", userId, communityId, ban.ExpiresAt.Format(time.RFC3339))
+}
+
+/*
+Fails if the user is banned from the community of a post or comment. For a cross-post that is the community it was shared to.
+*/
+func (s *SmartContract) checkItemBan(ctx contractapi.TransactionContextInterface, itemId string, userId string) error {
+	itemType, err := s.getItemType(ctx, itemId)
+	if err != nil {
+		return err
+	}
+	var communityId string
+	if itemType == postObjectType {
+		existingPost, err := s.GetPost(ctx, itemId)
+		if err != nil {
+			return err
+		}
+		communityId = existingPost.Community
+	} else {
+		existingComment, err := s.GetComment(ctx, itemId)
+		if err != nil {
+			return err
+		}
+		communityId = existingComment.Community
+	}
+	return s.checkNotBanned(ctx, communityId, userId)
+}
+
+/*
+Bans a user from a community, removing them from its members. Only moderators of the community can ban, and moderators can't be banned.
+It takes an optional reason and an optional expiry in RFC 3339 format; an empty expiry bans the user until the ban is lifted.
+Banning a user who is already banned replaces the ban.
+*/
+func (s *SmartContract) BanUser(ctx contractapi.TransactionContextInterface, communityId string, targetUserId string, reason string, expiresAt string, userId string) (*Ban, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if contains(existingCommunity.Moderators, targetUserId) {
+		return nil, fmt.Errorf("User with ID %s is a moderator of community %s and cannot be banned", targetUserId, communityId)
+	}
+	targetUser, err := s.GetUser(ctx, targetUserId)
+	if err != nil {
+		return nil, err
+	}
+	if targetUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", targetUserId)
+	}
+	if len(reason) > MaxBanReasonLength {
+		return nil, fmt.Errorf("Ban reason can't be longer than %d characters", MaxBanReasonLength)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ban := Ban{
+		CommunityId: communityId,
+		UserId:      targetUserId,
+		BannedBy:    userId,
+		Reason:      reason,
+		CreatedAt:   currentTime,
+	}
+	if expiresAt != "" {
+		ban.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ban expiry %s", expiresAt)
+		}
+		if !ban.ExpiresAt.After(currentTime) {
+			return nil, fmt.Errorf("Ban expiry %s has already passed", expiresAt)
+		}
+		ban.ExpiresAt = ban.ExpiresAt.UTC()
+	}
+	existingBan, err := s.getBan(ctx, communityId, targetUserId)
+	if err != nil {
+		return nil, err
+	}
+	if existingBan != nil {
+		err = deleteBan(ctx, existingBan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, err := banKey(ctx, communityId, targetUserId)
+	if err != nil {
+		return nil, err
+	}
+	banJson, _ := json.Marshal(ban)
+	err = ctx.GetStub().PutState(key, banJson)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, banIndex, communityId, currentTime, targetUserId)
+	if err != nil {
+		return nil, err
+	}
+	if index := findIndex(existingCommunity.Users, targetUserId); index != -1 {
+		existingCommunity.Users = removeElement(existingCommunity.Users, index)
+		communityJson, _ := json.Marshal(existingCommunity)
+		putState(ctx, communityObjectType, communityId, communityJson)
+	}
+	if index := findIndex(targetUser.Communities, communityId); index != -1 {
+		targetUser.Communities = removeElement(targetUser.Communities, index)
+		userJson, _ := json.Marshal(targetUser)
+		putState(ctx, userObjectType, targetUserId, userJson)
+	}
+	request, err := s.getJoinRequest(ctx, communityId, targetUserId)
+	if err != nil {
+		return nil, err
+	}
+	if request != nil {
+		err = deleteJoinRequest(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logEntry := ModLogEntry{Action: ModActionBan, Moderator: userId, TargetUser: targetUserId, Reason: reason}
+	if !ban.ExpiresAt.IsZero() {
+		logEntry.ExpiresAt = ban.ExpiresAt.Format(time.RFC3339)
+	}
+	err = logModActions(ctx, communityId, logEntry)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, UserBannedEvent, BanEventPayload{CommunityId: communityId, UserId: targetUserId, Moderator: userId, Reason: reason, ExpiresAt: ban.ExpiresAt})
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+/*
+Lifts a user's ban from a community before it expires. Only moderators of the community can lift bans.
+The user isn't added back to the community and has to join it again.
+*/
+func (s *SmartContract) UnbanUser(ctx contractapi.TransactionContextInterface, communityId string, targetUserId string, userId string) error {
+	_, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	ban, err := s.getBan(ctx, communityId, targetUserId)
+	if err != nil {
+		return err
+	}
+	if ban == nil {
+		return fmt.Errorf("User with ID %s is not banned from community %s", targetUserId, communityId)
+	}
+	err = deleteBan(ctx, ban)
+	if err != nil {
+		return err
+	}
+	err = logModActions(ctx, communityId, ModLogEntry{Action: ModActionUnban, Moderator: userId, TargetUser: targetUserId})
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, UserUnbannedEvent, BanEventPayload{CommunityId: communityId, UserId: targetUserId, Moderator: userId})
+}
+
+/*
+Returns a page of a community's bans, newest first, including expired ones that haven't been lifted.
+Only moderators of the community can read them.
+*/
+func (s *SmartContract) GetCommunityBans(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string) (*BanPage, error) {
+	_, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	bans := make(map[string]*Ban)
+	entries, err := scanIndexes(ctx, banIndex, []string{communityId}, cursor, BansPerPage+1, func(bannedId string) (bool, error) {
+		ban, err := s.getBan(ctx, communityId, bannedId)
+		if err != nil || ban == nil {
+			return false, err
+		}
+		bans[bannedId] = ban
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, BansPerPage)
+	page := BanPage{
+		Bans:       make([]*Ban, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		page.Bans = append(page.Bans, bans[entry.itemId])
+	}
+	return &page, nil
+}
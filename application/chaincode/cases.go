@@ -0,0 +1,620 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A moderation case is stored under (moderationCase, case Id) and in its community's time-ordered case list.
+// While it is open, it is also listed by deadline under (openCaseIndex, "open", deadline sort key, case Id), so the service can find every case to expire.
+const (
+	caseObjectType = "moderationCase"
+	caseIndex      = "caseIndex"
+	openCaseIndex  = "openCaseIndex"
+)
+
+// States of a moderation case
+const (
+	CaseOpen    = "open"    //waiting for the moderators
+	CaseHidden  = "hidden"  //the moderators voted to hide the item
+	CaseUpheld  = "upheld"  //the moderators voted to keep the item
+	CaseExpired = "expired" //the deadline passed undecided and the default outcome was applied
+)
+
+const (
+	DefaultCaseDeadlineHours = 72
+	MaxCaseDeadlineHours     = 24 * 30
+	OpenCasesPerPage         = 100
+)
+
+/*
+How long moderators have to decide a case in a community, and what happens to the item if they don't.
+*/
+type CasePolicy struct {
+	DeadlineHours  int    `json:"deadlineHours"`
+	DefaultOutcome string `json:"defaultOutcome"` //hidden or upheld
+}
+
+var defaultCasePolicy = CasePolicy{
+	DeadlineHours:  DefaultCaseDeadlineHours,
+	DefaultOutcome: CaseUpheld,
+}
+
+type ModerationVote struct {
+	Moderator string    `json:"moderator"`
+	Vote      string    `json:"vote"`                                //"hide" or "show"
+	Rule      int       `json:"rule,omitempty" metadata:",optional"` //community rule cited by a hide vote
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+/*
+How a case was decided. The appeals are cleared once a case is decided, so their count and reasons are kept here.
+*/
+type CaseDecision struct {
+	Outcome    string         `json:"outcome"`  //hidden or upheld
+	TimedOut   bool           `json:"timedOut"` //the default outcome was applied at the deadline
+	DecidedAt  time.Time      `json:"decidedAt"`
+	Moderators int            `json:"moderators"` //moderators of the community when the case was decided
+	Quorum     int            `json:"quorum"`     //votes either way that decide the case
+	HideVotes  int            `json:"hideVotes"`
+	ShowVotes  int            `json:"showVotes"`
+	Rule       int            `json:"rule,omitempty" metadata:",optional"` //rule the item was hidden for
+	Appeals    int            `json:"appeals"`
+	Reasons    map[string]int `json:"reasons"`
+}
+
+/*
+Opened when enough members appeal a post or comment, and decided by a majority of the moderators
+or by the community's default outcome once the deadline passes.
+*/
+type ModerationCase struct {
+	ID             string           `json:"id"`
+	ItemId         string           `json:"itemId"`
+	ItemType       string           `json:"itemType"`
+	CommunityId    string           `json:"communityId"`
+	Author         string           `json:"author"`
+	State          string           `json:"state"`
+	OpenedAt       time.Time        `json:"openedAt"`
+	Deadline       time.Time        `json:"deadline"`
+	DefaultOutcome string           `json:"defaultOutcome"` //applied if the deadline passes undecided
+	Votes          []ModerationVote `json:"votes"`
+	Decision       *CaseDecision    `json:"decision,omitempty" metadata:",optional"`
+}
+
+type CaseDeadline struct {
+	CaseId   string    `json:"caseId"`
+	Deadline time.Time `json:"deadline"`
+}
+
+type CaseDeadlinePage struct {
+	Cases      []*CaseDeadline `json:"cases"`
+	NextCursor string          `json:"nextCursor"` //empty on the last page
+}
+
+type CaseEventPayload struct {
+	CaseId      string `json:"caseId"`
+	ItemId      string `json:"itemId"`
+	ItemType    string `json:"itemType"`
+	CommunityId string `json:"communityId"`
+	State       string `json:"state"`
+	Outcome     string `json:"outcome"`
+}
+
+type CasePolicyEventPayload struct {
+	CommunityId string     `json:"communityId"`
+	UserId      string     `json:"userId"`
+	Policy      CasePolicy `json:"policy"`
+}
+
+func casePolicy(community *Community) CasePolicy {
+	if community.CasePolicy == nil {
+		return defaultCasePolicy
+	}
+	return *community.CasePolicy
+}
+
+func caseQuorum(community *Community) int {
+	return int(math.Ceil(float64(len(community.Moderators)) / 2.0))
+}
+
+func (s *SmartContract) getCase(ctx contractapi.TransactionContextInterface, caseId string) (*ModerationCase, error) {
+	caseJson, err := getState(ctx, caseObjectType, caseId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation case from ledger: %w", err)
+	}
+	if caseJson == nil {
+		return nil, nil
+	}
+	var moderationCase ModerationCase
+	err = json.Unmarshal(caseJson, &moderationCase)
+	if err != nil {
+		return nil, err
+	}
+	return &moderationCase, nil
+}
+
+func saveCase(ctx contractapi.TransactionContextInterface, moderationCase *ModerationCase) error {
+	caseJson, _ := json.Marshal(moderationCase)
+	return putState(ctx, caseObjectType, moderationCase.ID, caseJson)
+}
+
+/*
+Returns the hide and show votes of a case in the per-item form posts and comments keep.
+*/
+func caseVoteLists(moderationCase *ModerationCase) ([]string, []string, map[string]int) {
+	hideVote := make([]string, 0)
+	showVote := make([]string, 0)
+	var hideRules map[string]int
+	for _, vote := range moderationCase.Votes {
+		if vote.Vote == "show" {
+			showVote = append(showVote, vote.Moderator)
+			continue
+		}
+		hideVote = append(hideVote, vote.Moderator)
+		if vote.Rule > 0 {
+			if hideRules == nil {
+				hideRules = make(map[string]int)
+			}
+			hideRules[vote.Moderator] = vote.Rule
+		}
+	}
+	return hideVote, showVote, hideRules
+}
+
+func caseOutcome(moderationCase *ModerationCase) string {
+	if moderationCase.Decision == nil {
+		return ""
+	}
+	return moderationCase.Decision.Outcome
+}
+
+/*
+Brings the post or comment of a case in line with it: the item points at the case, its vote lists mirror the case's votes,
+and it is hidden once the case is decided that way. A hidden post leaves the community's posts and a hidden comment
+leaves its parent's replies; the caller stores the community. Also fills in the author of the case and the rule it was hidden for.
+*/
+func (s *SmartContract) syncCaseItem(ctx contractapi.TransactionContextInterface, moderationCase *ModerationCase, community *Community) error {
+	hidden := caseOutcome(moderationCase) == CaseHidden
+	hideVote, showVote, hideRules := caseVoteLists(moderationCase)
+	if moderationCase.ItemType == postObjectType {
+		existingPost, err := s.GetPost(ctx, moderationCase.ItemId)
+		if err != nil {
+			return err
+		}
+		if existingPost == nil {
+			return fmt.Errorf("Post with ID %s doesn't exists", moderationCase.ItemId)
+		}
+		moderationCase.Author = existingPost.Author
+		existingPost.Case = moderationCase.ID
+		existingPost.HideVote, existingPost.ShowVote, existingPost.HideRules = hideVote, showVote, hideRules
+		existingPost.HideCount = len(hideVote)
+		existingPost.ShowCount = len(showVote)
+		if hidden {
+			existingPost.Hidden = true
+			existingPost.HiddenRule = mostCitedRule(hideRules)
+			moderationCase.Decision.Rule = existingPost.HiddenRule
+			if index := findIndex(community.Posts, existingPost.ID); index != -1 {
+				community.Posts = removeElement(community.Posts, index)
+			}
+		}
+		postJson, _ := json.Marshal(existingPost)
+		return putState(ctx, postObjectType, existingPost.ID, postJson)
+	}
+	existingComment, err := s.GetComment(ctx, moderationCase.ItemId)
+	if err != nil {
+		return err
+	}
+	if existingComment == nil {
+		return fmt.Errorf("Comment with ID %s doesn't exists", moderationCase.ItemId)
+	}
+	moderationCase.Author = existingComment.Author
+	existingComment.Case = moderationCase.ID
+	existingComment.HideVote, existingComment.ShowVote, existingComment.HideRules = hideVote, showVote, hideRules
+	existingComment.HideCount = len(hideVote)
+	existingComment.ShowCount = len(showVote)
+	if hidden {
+		existingComment.Hidden = true
+		existingComment.HiddenRule = mostCitedRule(hideRules)
+		moderationCase.Decision.Rule = existingComment.HiddenRule
+		parentId := existingComment.Parent
+		parentType, err := s.getItemType(ctx, parentId)
+		if err != nil {
+			return err
+		}
+		if parentType == postObjectType {
+			existingParent, err := s.GetPost(ctx, parentId)
+			if err != nil {
+				return err
+			}
+			if index := findIndex(existingParent.Comments, existingComment.ID); index != -1 {
+				existingParent.Comments = removeElement(existingParent.Comments, index)
+				parentJson, _ := json.Marshal(existingParent)
+				putState(ctx, postObjectType, parentId, parentJson)
+			}
+		} else {
+			existingParent, err := s.GetComment(ctx, parentId)
+			if err != nil {
+				return err
+			}
+			if index := findIndex(existingParent.Replies, existingComment.ID); index != -1 {
+				existingParent.Replies = removeElement(existingParent.Replies, index)
+				parentJson, _ := json.Marshal(existingParent)
+				putState(ctx, commentObjectType, parentId, parentJson)
+			}
+		}
+	}
+	commentJson, _ := json.Marshal(existingComment)
+	return putState(ctx, commentObjectType, existingComment.ID, commentJson)
+}
+
+/*
+Opens a case for an appealed item and puts the item in the community's moderator queue. The caller stores the community.
+*/
+func (s *SmartContract) openCase(ctx contractapi.TransactionContextInterface, community *Community, itemId string, itemType string) (*ModerationCase, error) {
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy := casePolicy(community)
+	moderationCase := ModerationCase{
+		ID:             newEntityId(ctx, "mc"),
+		ItemId:         itemId,
+		ItemType:       itemType,
+		CommunityId:    community.ID,
+		State:          CaseOpen,
+		OpenedAt:       currentTime,
+		Deadline:       currentTime.Add(time.Duration(policy.DeadlineHours) * time.Hour),
+		DefaultOutcome: policy.DefaultOutcome,
+		Votes:          make([]ModerationVote, 0),
+	}
+	err = s.syncCaseItem(ctx, &moderationCase, community)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(community.Appealed, itemId) {
+		community.Appealed = append(community.Appealed, itemId)
+	}
+	err = putIndexEntry(ctx, caseIndex, community.ID, currentTime, moderationCase.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, openCaseIndex, CaseOpen, moderationCase.Deadline, moderationCase.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = saveCase(ctx, &moderationCase)
+	if err != nil {
+		return nil, err
+	}
+	return &moderationCase, nil
+}
+
+/*
+Returns the open case of an item, nil if it has none.
+*/
+func (s *SmartContract) openItemCase(ctx contractapi.TransactionContextInterface, itemId string, itemType string) (*ModerationCase, error) {
+	caseId := ""
+	if itemType == postObjectType {
+		existingPost, err := s.GetPost(ctx, itemId)
+		if err != nil {
+			return nil, err
+		}
+		caseId = existingPost.Case
+	} else {
+		existingComment, err := s.GetComment(ctx, itemId)
+		if err != nil {
+			return nil, err
+		}
+		caseId = existingComment.Case
+	}
+	if caseId == "" {
+		return nil, nil
+	}
+	moderationCase, err := s.getCase(ctx, caseId)
+	if err != nil || moderationCase == nil || moderationCase.State != CaseOpen {
+		return nil, err
+	}
+	return moderationCase, nil
+}
+
+/*
+Decides a case: records the vote breakdown and the appeals, applies the outcome to the item, takes the item
+out of the moderator queue and clears its appeals. A case decided at its deadline ends up expired.
+The caller stores the community.
+*/
+func (s *SmartContract) decideCase(ctx contractapi.TransactionContextInterface, moderationCase *ModerationCase, community *Community, outcome string, timedOut bool) error {
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	appeals, err := s.itemAppeals(ctx, moderationCase.ItemId)
+	if err != nil {
+		return err
+	}
+	summary := summarizeAppeals(appeals, appealThreshold(community), false)
+	hideVote, showVote, _ := caseVoteLists(moderationCase)
+	moderationCase.Decision = &CaseDecision{
+		Outcome:    outcome,
+		TimedOut:   timedOut,
+		DecidedAt:  currentTime,
+		Moderators: len(community.Moderators),
+		Quorum:     caseQuorum(community),
+		HideVotes:  len(hideVote),
+		ShowVotes:  len(showVote),
+		Appeals:    summary.Count,
+		Reasons:    summary.Reasons,
+	}
+	moderationCase.State = outcome
+	if timedOut {
+		moderationCase.State = CaseExpired
+	}
+	err = s.syncCaseItem(ctx, moderationCase, community)
+	if err != nil {
+		return err
+	}
+	if index := findIndex(community.Appealed, moderationCase.ItemId); index != -1 {
+		community.Appealed = removeElement(community.Appealed, index)
+	}
+	err = s.clearAppeals(ctx, moderationCase.ItemId)
+	if err != nil {
+		return err
+	}
+	openKey, err := ctx.GetStub().CreateCompositeKey(openCaseIndex, []string{CaseOpen, indexSortKey(moderationCase.Deadline), moderationCase.ID})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelState(openKey)
+	if err != nil {
+		return err
+	}
+	err = saveCase(ctx, moderationCase)
+	if err != nil {
+		return err
+	}
+	if outcome == CaseHidden {
+		return s.notify(ctx, moderationCase.Author, NotificationContentHidden, "", moderationCase.ItemId, moderationCase.ItemType, community.ID, moderationCase.Decision.Rule)
+	}
+	return nil
+}
+
+/*
+Records a moderator's hide or show vote on the open case of a post or comment, and decides the case
+once either side reaches a majority of the community's moderators.
+*/
+func (s *SmartContract) castModerationVote(ctx contractapi.TransactionContextInterface, itemId string, userId string, vote string, rule int) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	itemType, communityId, _, err := s.appealTarget(ctx, itemId)
+	if err != nil {
+		return err
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return err
+	}
+	if !contains(existingCommunity.Moderators, userId) {
+		return fmt.Errorf("User cannot %s as you are not a moderator", vote)
+	}
+	moderationCase, err := s.openItemCase(ctx, itemId, itemType)
+	if err != nil {
+		return err
+	}
+	if moderationCase == nil {
+		return fmt.Errorf("Item with ID %s has no open moderation case", itemId)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !currentTime.Before(moderationCase.Deadline) {
+		return fmt.Errorf("Moderation case %s passed its deadline and can only expire", moderationCase.ID)
+	}
+	for _, existingVote := range moderationCase.Votes {
+		if existingVote.Moderator == userId {
+			return fmt.Errorf("User already voted")
+		}
+	}
+	if vote == "hide" {
+		err = validateCitedRule(existingCommunity, rule)
+		if err != nil {
+			return err
+		}
+	} else {
+		rule = 0
+	}
+	moderationCase.Votes = append(moderationCase.Votes, ModerationVote{Moderator: userId, Vote: vote, Rule: rule, CreatedAt: currentTime})
+	hideVote, showVote, _ := caseVoteLists(moderationCase)
+	outcome := ""
+	if len(hideVote) >= caseQuorum(existingCommunity) {
+		outcome = CaseHidden
+	} else if len(showVote) >= caseQuorum(existingCommunity) {
+		outcome = CaseUpheld
+	}
+	if outcome == "" {
+		err = s.syncCaseItem(ctx, moderationCase, existingCommunity)
+		if err != nil {
+			return err
+		}
+		err = saveCase(ctx, moderationCase)
+	} else {
+		err = s.decideCase(ctx, moderationCase, existingCommunity, outcome, false)
+		communityJson, _ := json.Marshal(existingCommunity)
+		putState(ctx, communityObjectType, communityId, communityJson)
+	}
+	if err != nil {
+		return err
+	}
+	logEntry := ModLogEntry{Action: ModActionHide, Moderator: userId, TargetUser: moderationCase.Author, ItemId: itemId, ItemType: itemType, Rule: rule}
+	if vote == "show" {
+		logEntry.Action = ModActionShow
+	}
+	if outcome == CaseHidden {
+		logEntry.Outcome = "hidden"
+	} else if outcome == CaseUpheld {
+		logEntry.Outcome = "shown"
+	}
+	err = logModActions(ctx, communityId, logEntry)
+	if err != nil {
+		return err
+	}
+	eventType := ModerationVoteEvent
+	if outcome == CaseHidden {
+		eventType = ContentHiddenEvent
+	} else if outcome == CaseUpheld {
+		eventType = ContentShownEvent
+	}
+	return emitEvent(ctx, eventType, ContentEventPayload{ItemId: itemId, ItemType: itemType, CommunityId: communityId, UserId: userId, Vote: vote, Rule: rule, CaseId: moderationCase.ID})
+}
+
+/*
+Applies the default outcome to a case its moderators didn't decide before the deadline.
+Anyone can expire a case once the deadline has passed; the service does so on schedule.
+*/
+func (s *SmartContract) ExpireCase(ctx contractapi.TransactionContextInterface, caseId string) (*ModerationCase, error) {
+	moderationCase, err := s.getCase(ctx, caseId)
+	if err != nil {
+		return nil, err
+	}
+	if moderationCase == nil {
+		return nil, fmt.Errorf("Moderation case with ID %s doesn't exists", caseId)
+	}
+	if moderationCase.State != CaseOpen {
+		return nil, fmt.Errorf("Moderation case %s is already %s", caseId, moderationCase.State)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentTime.Before(moderationCase.Deadline) {
+		return nil, fmt.Errorf("Moderation case %s is open until %s", caseId, moderationCase.Deadline.Format(time.RFC3339))
+	}
+	existingCommunity, err := s.GetCommunity(ctx, moderationCase.CommunityId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.decideCase(ctx, moderationCase, existingCommunity, moderationCase.DefaultOutcome, true)
+	if err != nil {
+		return nil, err
+	}
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, existingCommunity.ID, communityJson)
+	logEntry := ModLogEntry{Action: ModActionExpire, TargetUser: moderationCase.Author, ItemId: moderationCase.ItemId, ItemType: moderationCase.ItemType, Rule: moderationCase.Decision.Rule, Outcome: "shown"}
+	if moderationCase.DefaultOutcome == CaseHidden {
+		logEntry.Outcome = "hidden"
+	}
+	err = logModActions(ctx, existingCommunity.ID, logEntry)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, CaseExpiredEvent, CaseEventPayload{CaseId: caseId, ItemId: moderationCase.ItemId, ItemType: moderationCase.ItemType, CommunityId: existingCommunity.ID, State: moderationCase.State, Outcome: moderationCase.DefaultOutcome})
+	if err != nil {
+		return nil, err
+	}
+	return moderationCase, nil
+}
+
+func validateCasePolicy(policy CasePolicy) error {
+	if policy.DeadlineHours < 1 || policy.DeadlineHours > MaxCaseDeadlineHours {
+		return fmt.Errorf("Case deadline must be between 1 and %d hours", MaxCaseDeadlineHours)
+	}
+	if policy.DefaultOutcome != CaseHidden && policy.DefaultOutcome != CaseUpheld {
+		return fmt.Errorf("Invalid default outcome %s", policy.DefaultOutcome)
+	}
+	return nil
+}
+
+/*
+Replaces a community's case policy, given as a JSON object. Only moderators of the community can change it.
+Cases that are already open keep the deadline and default outcome they were opened with.
+*/
+func (s *SmartContract) SetCasePolicy(ctx contractapi.TransactionContextInterface, communityId string, policyJson string, userId string) (*CasePolicy, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	var policy CasePolicy
+	err = json.Unmarshal([]byte(policyJson), &policy)
+	if err != nil {
+		return nil, fmt.Errorf("Case policy must be a JSON object: %w", err)
+	}
+	err = validateCasePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity.CasePolicy = &policy
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	err = emitEvent(ctx, CasePolicyChangedEvent, CasePolicyEventPayload{CommunityId: communityId, UserId: userId, Policy: policy})
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+/*
+Returns a community's case policy.
+*/
+func (s *SmartContract) GetCasePolicy(ctx contractapi.TransactionContextInterface, communityId string) (*CasePolicy, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	policy := casePolicy(existingCommunity)
+	return &policy, nil
+}
+
+/*
+Returns a moderation case. Anyone who can read the community can read its cases.
+*/
+func (s *SmartContract) GetModerationCase(ctx contractapi.TransactionContextInterface, caseId string, userId string) (*ModerationCase, error) {
+	moderationCase, err := s.getCase(ctx, caseId)
+	if err != nil {
+		return nil, err
+	}
+	if moderationCase == nil {
+		return nil, fmt.Errorf("Moderation case with ID %s doesn't exists", caseId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, moderationCase.CommunityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	return moderationCase, nil
+}
+
+/*
+Returns a page of the open moderation cases of every community, with their deadlines, latest deadline first.
+Only the case Ids and deadlines are listed, so the service can schedule ExpireCase for each case, including cases it didn't open itself.
+*/
+func (s *SmartContract) GetOpenCases(ctx contractapi.TransactionContextInterface, cursor string) (*CaseDeadlinePage, error) {
+	cases := make(map[string]*ModerationCase)
+	entries, err := scanIndexes(ctx, openCaseIndex, []string{CaseOpen}, cursor, OpenCasesPerPage+1, func(caseId string) (bool, error) {
+		moderationCase, err := s.getCase(ctx, caseId)
+		if err != nil || moderationCase == nil || moderationCase.State != CaseOpen {
+			return false, err
+		}
+		cases[caseId] = moderationCase
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, OpenCasesPerPage)
+	page := CaseDeadlinePage{
+		Cases:      make([]*CaseDeadline, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		page.Cases = append(page.Cases, &CaseDeadline{CaseId: entry.itemId, Deadline: cases[entry.itemId].Deadline})
+	}
+	return &page, nil
+}
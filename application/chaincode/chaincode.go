@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"sort"
+	"strconv"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -27,6 +27,7 @@ type User struct {
 	Posts       []string `json:"posts"` //list of ids
 	Comments    []string `json:"comments"`
 	Reputation  int
+	CreatedAt   time.Time `json:"createdAt" metadata:",optional"` //zero for accounts created before it was recorded
 }
 
 type UserModified struct {
@@ -34,28 +35,49 @@ type UserModified struct {
 	Username   string `json:"username"`
 	Email      string `json:"email"`
 	Reputation int    `json:"reputation"`
+	Followers  int    `json:"followers"`
+	Following  int    `json:"following"`
 }
 
 type Community struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Creator     string    `json:"creator"`
-	CreatedAt   time.Time `json:"createdAt"`
-	Moderators  []string  `json:"moderators"`
-	Users       []string  `json:"users"`
-	Posts       []string  `json:"posts"` //list of ids
-	Appealed    []string
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	Creator            string    `json:"creator"`
+	CreatedAt          time.Time `json:"createdAt"`
+	Moderators         []string  `json:"moderators"`
+	Users              []string  `json:"users"`
+	Posts              []string  `json:"posts"` //list of ids
+	Appealed           []string
+	Flairs             []Flair              `json:"flairs,omitempty" metadata:",optional"`             //flair catalog, edited by moderators
+	Rules              []CommunityRule      `json:"rules,omitempty" metadata:",optional"`              //ordered rule list, edited by moderators
+	Requirements       *PostingRequirements `json:"requirements,omitempty" metadata:",optional"`       //requirements for new posts and comments
+	Visibility         string               `json:"visibility,omitempty" metadata:",optional"`         //public, restricted or private; empty is public
+	ModeratorSelection string               `json:"moderatorSelection,omitempty" metadata:",optional"` //reputation or election; empty is reputation
+	Election           string               `json:"election,omitempty" metadata:",optional"`           //Id of the running election
+	Scoring            *ModeratorScoring    `json:"scoring,omitempty" metadata:",optional"`            //how SelectModerator scores members, nil for the default
+	AppealThreshold    int                  `json:"appealThreshold,omitempty" metadata:",optional"`    //distinct appeals that queue an item; 0 is DefaultAppealThreshold
+	CasePolicy         *CasePolicy          `json:"casePolicy,omitempty" metadata:",optional"`         //deadline and default outcome of moderation cases, nil for the default
+	Appointed          []string             `json:"appointed,omitempty" metadata:",optional"`          //moderators added with AddModerator, which SelectModerator keeps
+	ModeratorsSelected time.Time            `json:"moderatorsSelected" metadata:",optional"`           //when SelectModerator last ran, zero if it hasn't
 }
 
 type CommunityModified struct {
-	ID          string         `json:"id"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Creator     string         `json:"creator"`
-	CreatedAt   time.Time      `json:"createdAt"`
-	Moderators  []UserModified `json:"moderators"`
-	Users       []UserModified `json:"users"`
+	ID                 string              `json:"id"`
+	Name               string              `json:"name"`
+	Description        string              `json:"description"`
+	Creator            string              `json:"creator"`
+	CreatedAt          time.Time           `json:"createdAt"`
+	Moderators         []UserModified      `json:"moderators"`
+	Users              []UserModified      `json:"users"`
+	Flairs             []Flair             `json:"flairs"`
+	Rules              []CommunityRule     `json:"rules"`
+	Requirements       PostingRequirements `json:"requirements"`
+	Visibility         string              `json:"visibility"`
+	ModeratorSelection string              `json:"moderatorSelection"`
+	Election           string              `json:"election"` //Id of the running election, empty if none
+	AppealThreshold    int                 `json:"appealThreshold"`
+	CasePolicy         CasePolicy          `json:"casePolicy"`
 }
 
 type CommunityName struct {
@@ -64,64 +86,87 @@ type CommunityName struct {
 }
 
 type Post struct {
-	ID        string    `json:"id"` // should start with p
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	Score     int       `json:"score"`
-	CreatedAt time.Time `json:"createdAt"`
-	Comments  []string  `json:"comments"` //list of ids
-	Hidden    bool
-	Community string
-	HideCount int
-	ShowCount int
-	UpVote    []string
-	DownVote  []string
-	HideVote  []string
-	ShowVote  []string
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	Author      string    `json:"author"`
+	Score       int       `json:"score"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Comments    []string  `json:"comments"` //list of ids
+	Hidden      bool
+	Community   string
+	HideCount   int
+	ShowCount   int
+	HideVote    []string
+	ShowVote    []string
+	Revisions   int            `json:"revisions"` //number of earlier versions kept in the revision history
+	EditedAt    time.Time      `json:"editedAt"`
+	Flair       string         `json:"flair"` //Id of a flair from the community's catalog, empty if none
+	Type        string         `json:"type"`  //text or poll; posts created before poll posts existed have none and are text
+	Poll        *Poll          `json:"poll,omitempty" metadata:",optional"`
+	CrossPostOf string         `json:"crossPostOf"`                               //Id of the original post, for a cross-post
+	CrossPosts  []string       `json:"crossPosts,omitempty" metadata:",optional"` //Ids of the cross-posts of an original post
+	HideRules   map[string]int `json:"hideRules,omitempty" metadata:",optional"`  //rule cited by each moderator's hide vote
+	HiddenRule  int            `json:"hiddenRule,omitempty" metadata:",optional"` //rule the post was hidden for, 0 if none was cited
+	Case        string         `json:"case,omitempty" metadata:",optional"`       //Id of the post's latest moderation case
 }
 
 type PostModified struct {
-	ID            string    `json:"id"` // should start with p
-	Title         string    `json:"title"`
-	Content       string    `json:"content"`
-	Author        string    `json:"author"`
-	Score         int       `json:"score"`
-	CreatedAt     time.Time `json:"createdAt"`
-	Comments      []string  `json:"comments"` //list of ids
-	Hidden        bool      `json:"hidden"`
-	Community     string    `json:"community"`
-	HideCount     int       `json:"hideCount"`
-	ShowCount     int       `json:"showCount"`
-	AuthorName    string    `json:"authorName"`
-	CommunityName string    `json:"communityName"`
-	HasUpvoted    bool      `json:"hasUpvoted"`
-	HasDownvoted  bool      `json:"hasDownvoted"`
-	HasHideVoted  bool      `json:"hasHidevoted"`
-	HasShowVoted  bool      `json:"hasShowvoted"`
-	IsAppealed    bool      `json:"isAppealed"`
+	ID            string       `json:"id"`
+	Title         string       `json:"title"`
+	Content       string       `json:"content"`
+	Author        string       `json:"author"`
+	Score         int          `json:"score"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	Comments      []string     `json:"comments"` //list of ids
+	Hidden        bool         `json:"hidden"`
+	Community     string       `json:"community"`
+	HideCount     int          `json:"hideCount"`
+	ShowCount     int          `json:"showCount"`
+	AuthorName    string       `json:"authorName"`
+	CommunityName string       `json:"communityName"`
+	HasUpvoted    bool         `json:"hasUpvoted"`
+	HasDownvoted  bool         `json:"hasDownvoted"`
+	HasHideVoted  bool         `json:"hasHidevoted"`
+	HasShowVoted  bool         `json:"hasShowvoted"`
+	IsAppealed    bool         `json:"isAppealed"`
+	Edited        bool         `json:"edited"`
+	EditedAt      time.Time    `json:"editedAt"`
+	Flair         *Flair       `json:"flair,omitempty" metadata:",optional"`
+	Type          string       `json:"type"`
+	Poll          *PollResults `json:"poll,omitempty" metadata:",optional"` //set for poll posts
+	// Set for a cross-post, whose content, score and comments are those of the original post
+	CrossPostOf           string `json:"crossPostOf,omitempty" metadata:",optional"`
+	CrossPostedBy         string `json:"crossPostedBy,omitempty" metadata:",optional"`
+	OriginalCommunity     string `json:"originalCommunity,omitempty" metadata:",optional"`
+	OriginalCommunityName string `json:"originalCommunityName,omitempty" metadata:",optional"`
+	HiddenRule            int    `json:"hiddenRule,omitempty" metadata:",optional"` //rule the post was hidden for
+	Case                  string `json:"case,omitempty" metadata:",optional"`       //Id of the latest moderation case
 }
 
 type Comment struct {
-	ID        string    `json:"id"` //should syart with c
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	Score     int       `json:"score"`
-	CreatedAt time.Time `json:"createdAt"`
-	Parent    string    //can be comment or id
-	Replies   []string  `json:"replies"` //list of ids
-	Hidden    bool
-	Community string
-	HideCount int
-	ShowCount int
-	UpVote    []string
-	DownVote  []string
-	HideVote  []string
-	ShowVote  []string
+	ID         string    `json:"id"`
+	Content    string    `json:"content"`
+	Author     string    `json:"author"`
+	Score      int       `json:"score"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Parent     string    //can be comment or id
+	Replies    []string  `json:"replies"` //list of ids
+	Hidden     bool
+	Community  string
+	HideCount  int
+	ShowCount  int
+	HideVote   []string
+	ShowVote   []string
+	Revisions  int            `json:"revisions"` //number of earlier versions kept in the revision history
+	EditedAt   time.Time      `json:"editedAt"`
+	HideRules  map[string]int `json:"hideRules,omitempty" metadata:",optional"`  //rule cited by each moderator's hide vote
+	HiddenRule int            `json:"hiddenRule,omitempty" metadata:",optional"` //rule the comment was hidden for, 0 if none was cited
+	Case       string         `json:"case,omitempty" metadata:",optional"`       //Id of the comment's latest moderation case
 }
 
 type CommentModified struct {
-	ID            string    `json:"id"` //should syart with c
+	ID            string    `json:"id"`
 	Content       string    `json:"content"`
 	Author        string    `json:"author"`
 	Score         int       `json:"score"`
@@ -139,11 +184,45 @@ type CommentModified struct {
 	IsAppealed    bool      `json:"isAppealed"`
 	HasHideVoted  bool      `json:"hasHidevoted"`
 	HasShowVoted  bool      `json:"hasShowvoted"`
+	Edited        bool      `json:"edited"`
+	EditedAt      time.Time `json:"editedAt"`
+	HiddenRule    int       `json:"hiddenRule,omitempty" metadata:",optional"` //rule the comment was hidden for
+	Case          string    `json:"case,omitempty" metadata:",optional"`       //Id of the latest moderation case
+}
+
+type Vote struct {
+	Item      string `json:"item"`
+	Voter     string `json:"voter"`
+	Direction int    `json:"direction"` // 1 for upvote, -1 for downvote
 }
 
 const PostsPerPage = 20
 const CommentsPerPage = 20
 
+// Object types used as the first component of every composite key on the ledger
+const (
+	userObjectType      = "user"
+	communityObjectType = "community"
+	postObjectType      = "post"
+	commentObjectType   = "comment"
+	metaDataObjectType  = "metadata"
+)
+
+// Object types for per-vote records and the delta keys that aggregate them
+const (
+	voteObjectType            = "vote"
+	scoreDeltaObjectType      = "scoreDelta"
+	reputationDeltaObjectType = "reputationDelta"
+)
+
+// Object type for the earlier versions of edited posts and comments
+const revisionObjectType = "revision"
+
+const metaDataId = "md"
+
+// Name of the X.509 certificate attribute, set by the CA at enrollment, that carries the user's Id
+const userIdAttribute = "userId"
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -180,6 +259,104 @@ func findIndex(slice []string, target string) int {
 	return -1 // Return -1 if the element is not found
 }
 
+/*
+Builds the composite key under which an entity of the given object type is stored.
+Keeping every entity under its own object type means a user Id can never collide with a post or comment Id.
+*/
+func entityKey(ctx contractapi.TransactionContextInterface, objectType string, id string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s key for ID %s: %w", objectType, id, err)
+	}
+	return key, nil
+}
+
+func getState(ctx contractapi.TransactionContextInterface, objectType string, id string) ([]byte, error) {
+	key, err := entityKey(ctx, objectType, id)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.GetStub().GetState(key)
+}
+
+func putState(ctx contractapi.TransactionContextInterface, objectType string, id string, value []byte) error {
+	key, err := entityKey(ctx, objectType, id)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, value)
+}
+
+/*
+Resolves the acting user from the "userId" attribute that the CA embeds in the caller's X.509 certificate.
+*/
+func getCallerId(ctx contractapi.TransactionContextInterface) (string, error) {
+	callerId, found, err := ctx.GetClientIdentity().GetAttributeValue(userIdAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read caller identity: %w", err)
+	}
+	if !found || callerId == "" {
+		return "", fmt.Errorf("caller identity doesn't carry a %s attribute", userIdAttribute)
+	}
+	return callerId, nil
+}
+
+/*
+Rejects the transaction unless the user Id claimed in its arguments is the user that signed it.
+Every mutating transaction calls this before touching the ledger, so a client cannot act on behalf of another user.
+*/
+func authorizeCaller(ctx contractapi.TransactionContextInterface, userId string) error {
+	callerId, err := getCallerId(ctx)
+	if err != nil {
+		return err
+	}
+	if callerId != userId {
+		return fmt.Errorf("User with ID %s cannot act as user %s", callerId, userId)
+	}
+	return nil
+}
+
+/*
+Derives the Id of an entity created in this transaction from the transaction Id, so every endorser computes the same Id.
+*/
+func newEntityId(ctx contractapi.TransactionContextInterface, prefix string) string {
+	return prefix + "_" + ctx.GetStub().GetTxID()
+}
+
+/*
+Returns the transaction timestamp, which every endorser of the transaction sees identically.
+Used as the creation time of entities instead of a client supplied value.
+*/
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %w", err)
+	}
+	return timestamp.AsTime(), nil
+}
+
+/*
+Resolves whether an Id refers to a post or a comment by looking it up under each object type.
+Returns an error if the Id is stored under neither.
+*/
+func (s *SmartContract) getItemType(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	postJson, err := getState(ctx, postObjectType, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to read post from ledger: %w", err)
+	}
+	if postJson != nil {
+		return postObjectType, nil
+	}
+	commentJson, err := getState(ctx, commentObjectType, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to read comment from ledger: %w", err)
+	}
+	if commentJson != nil {
+		return commentObjectType, nil
+	}
+	return "", fmt.Errorf("Post or comment with ID %s doesn't exists", id)
+}
+
 /*
 InitLedger is used to setup initial data on the blockchain for interaction
 */
@@ -242,8 +419,6 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 		Community: "co_1",
 		HideCount: 0,
 		ShowCount: 0,
-		UpVote:    make([]string, 0),
-		DownVote:  make([]string, 0),
 		HideVote:  make([]string, 0),
 		ShowVote:  make([]string, 0),
 	}
@@ -261,10 +436,9 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 		Community: "co_1",
 		HideCount: 0,
 		ShowCount: 0,
-		UpVote:    make([]string, 0),
-		DownVote:  make([]string, 0),
 		HideVote:  make([]string, 0),
 		ShowVote:  make([]string, 0),
+		Case:      "mc_1",
 	}
 	// post3 := Post{
 	// 	ID:        "p_3",
@@ -295,8 +469,6 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 		Community: "co_1",
 		HideCount: 0,
 		ShowCount: 0,
-		UpVote:    make([]string, 0),
-		DownVote:  make([]string, 0),
 		HideVote:  make([]string, 0),
 		ShowVote:  make([]string, 0),
 	}
@@ -312,8 +484,6 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 		Community: "co_1",
 		HideCount: 0,
 		ShowCount: 0,
-		UpVote:    make([]string, 0),
-		DownVote:  make([]string, 0),
 		HideVote:  make([]string, 0),
 		ShowVote:  make([]string, 0),
 	}
@@ -322,14 +492,14 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 		Name: "Comm1",
 	}
 	metaData := MetaData{
-		ID:   "md",
+		ID:   metaDataId,
 		Name: []CommunityName{communityName1},
 	}
 	user1JSON, err := json.Marshal(user1)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(user1.ID, user1JSON)
+	err = putState(ctx, userObjectType, user1.ID, user1JSON)
 	if err != nil {
 		return err
 	}
@@ -338,7 +508,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(user2.ID, user2JSON)
+	err = putState(ctx, userObjectType, user2.ID, user2JSON)
 	if err != nil {
 		return err
 	}
@@ -347,7 +517,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(community.ID, communityJson)
+	err = putState(ctx, communityObjectType, community.ID, communityJson)
 	if err != nil {
 		return err
 	}
@@ -363,7 +533,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(post1.ID, post1Json)
+	err = putState(ctx, postObjectType, post1.ID, post1Json)
 	if err != nil {
 		return err
 	}
@@ -372,7 +542,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(post2.ID, post2Json)
+	err = putState(ctx, postObjectType, post2.ID, post2Json)
 	if err != nil {
 		return err
 	}
@@ -388,7 +558,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(comment1.ID, comment1Json)
+	err = putState(ctx, commentObjectType, comment1.ID, comment1Json)
 	if err != nil {
 		return err
 	}
@@ -397,7 +567,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(comment2.ID, comment2Json)
+	err = putState(ctx, commentObjectType, comment2.ID, comment2Json)
 	if err != nil {
 		return err
 	}
@@ -405,11 +575,72 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(metaData.ID, metaDataJson)
+	err = putState(ctx, metaDataObjectType, metaData.ID, metaDataJson)
 	if err != nil {
 		return err
 	}
-	return nil
+	for _, post := range []Post{post1, post2} {
+		err = putIndexEntry(ctx, communityPostIndex, post.Community, post.CreatedAt, post.ID)
+		if err != nil {
+			return err
+		}
+		err = putIndexEntry(ctx, authorPostIndex, post.Author, post.CreatedAt, post.ID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, comment := range []Comment{comment1, comment2} {
+		err = putIndexEntry(ctx, childCommentIndex, comment.Parent, comment.CreatedAt, comment.ID)
+		if err != nil {
+			return err
+		}
+		err = putIndexEntry(ctx, authorCommentIndex, comment.Author, comment.CreatedAt, comment.ID)
+		if err != nil {
+			return err
+		}
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	moderationCase := ModerationCase{
+		ID:             post2.Case,
+		ItemId:         post2.ID,
+		ItemType:       postObjectType,
+		CommunityId:    community.ID,
+		Author:         post2.Author,
+		State:          CaseOpen,
+		OpenedAt:       currentTime,
+		Deadline:       currentTime.Add(time.Duration(defaultCasePolicy.DeadlineHours) * time.Hour),
+		DefaultOutcome: defaultCasePolicy.DefaultOutcome,
+		Votes:          make([]ModerationVote, 0),
+	}
+	err = saveCase(ctx, &moderationCase)
+	if err != nil {
+		return err
+	}
+	err = putIndexEntry(ctx, caseIndex, community.ID, currentTime, moderationCase.ID)
+	if err != nil {
+		return err
+	}
+	err = putIndexEntry(ctx, openCaseIndex, CaseOpen, moderationCase.Deadline, moderationCase.ID)
+	if err != nil {
+		return err
+	}
+	appeal := Appeal{
+		ItemId:      post2.ID,
+		ItemType:    postObjectType,
+		CommunityId: community.ID,
+		Reporter:    "1",
+		Reason:      AppealReasonOther,
+		CreatedAt:   post2.CreatedAt,
+	}
+	key, err := appealKey(ctx, appeal.ItemId, appeal.Reporter)
+	if err != nil {
+		return err
+	}
+	appealJson, _ := json.Marshal(appeal)
+	return ctx.GetStub().PutState(key, appealJson)
 }
 
 /*
@@ -417,13 +648,22 @@ Used to create a new user within a blockchain.
 It checks if the user already exists and, if not, initializes a new user with the provided user Id, username, and email.
 */
 func (s *SmartContract) CreateUser(ctx contractapi.TransactionContextInterface, UserId string, username string, email string) error {
+	err := authorizeCaller(ctx, UserId)
+	if err != nil {
+		return err
+	}
 	existingUser, err := s.GetUser(ctx, UserId)
 	if err == nil && existingUser != nil {
 		//return fmt.Errorf("User with ID %s already exists", UserId)
 		return nil
 	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
 	user := User{
 		ID:          UserId,
+		CreatedAt:   currentTime,
 		Username:    username,
 		Email:       email,
 		Communities: make([]string, 0),
@@ -432,12 +672,16 @@ func (s *SmartContract) CreateUser(ctx contractapi.TransactionContextInterface,
 		Comments:    make([]string, 0),
 	}
 	userJson, _ := json.Marshal(user)
-	return ctx.GetStub().PutState(UserId, userJson)
+	err = putState(ctx, userObjectType, UserId, userJson)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, UserCreatedEvent, user)
 
 }
 
 func (s *SmartContract) GetMetaData(ctx contractapi.TransactionContextInterface, metaDataId string) (*MetaData, error) {
-	metaJson, err := ctx.GetStub().GetState(metaDataId)
+	metaJson, err := getState(ctx, metaDataObjectType, metaDataId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read data from ledger: %w", err)
 	}
@@ -458,7 +702,7 @@ Used to retrieve User information from a  blockchain.
 It takes a user Id as a parameter and queries the ledger to fetch the corresponding user data.
 */
 func (s *SmartContract) GetUser(ctx contractapi.TransactionContextInterface, userId string) (*User, error) {
-	userJson, err := ctx.GetStub().GetState(userId)
+	userJson, err := getState(ctx, userObjectType, userId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read user from ledger: %w", err)
 	}
@@ -474,7 +718,7 @@ func (s *SmartContract) GetUser(ctx contractapi.TransactionContextInterface, use
 	return &user, nil
 }
 func (s *SmartContract) GetUserModified(ctx contractapi.TransactionContextInterface, userId string) (*UserModified, error) {
-	userJson, err := ctx.GetStub().GetState(userId)
+	userJson, err := getState(ctx, userObjectType, userId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read user from ledger: %w", err)
 	}
@@ -496,7 +740,7 @@ func (s *SmartContract) GetUserModified(ctx contractapi.TransactionContextInterf
 }
 
 func (s *SmartContract) GetCommunityModified(ctx contractapi.TransactionContextInterface, communityId string) (*CommunityModified, error) {
-	communityJson, err := ctx.GetStub().GetState(communityId)
+	communityJson, err := getState(ctx, communityObjectType, communityId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read community from ledger: %w", err)
 	}
@@ -519,30 +763,38 @@ func (s *SmartContract) GetCommunityModified(ctx contractapi.TransactionContextI
 
 /*
 Used to create a new community in a blockchain.
-It takes parameters such as the community's Id, name, description, creator, and creation timestamp.
+It takes parameters such as the community's name, description and creator.
+The community's Id and creation timestamp are derived from the transaction, and the created community is returned.
 Function also makes the creator, the initial moderator of the community.
 */
-func (s *SmartContract) CreateCommunity(ctx contractapi.TransactionContextInterface, id string, createdAt string, name string, description string, creator string) error {
+func (s *SmartContract) CreateCommunity(ctx contractapi.TransactionContextInterface, name string, description string, creator string) (*Community, error) {
+	err := authorizeCaller(ctx, creator)
+	if err != nil {
+		return nil, err
+	}
+	id := newEntityId(ctx, "co")
 	existingCommunity, err := s.GetCommunity(ctx, id)
 	if err == nil && existingCommunity != nil {
-		return fmt.Errorf("Community with ID %s already exists", id)
+		return nil, fmt.Errorf("Community with ID %s already exists", id)
 	}
 	existingUser, err := s.GetUser(ctx, creator)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if existingUser == nil {
-		return fmt.Errorf("User with ID %s doesn't exists", creator)
+		return nil, fmt.Errorf("User with ID %s doesn't exists", creator)
 	}
-	existingMetaData, err := s.GetMetaData(ctx, "md")
+	existingMetaData, err := s.GetMetaData(ctx, metaDataId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if existingMetaData == nil {
-		return fmt.Errorf("data  doesn't exists")
+		return nil, fmt.Errorf("data  doesn't exists")
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
 	}
-	layout := "2006-01-02T15:04:05.000Z"
-	currentTime, _ := time.Parse(layout, createdAt)
 	community := Community{
 		ID:          id,
 		Name:        name,
@@ -560,14 +812,22 @@ func (s *SmartContract) CreateCommunity(ctx contractapi.TransactionContextInterf
 	}
 	existingMetaData.Name = append(existingMetaData.Name, communityName)
 	metaDataJson, _ := json.Marshal(existingMetaData)
-	ctx.GetStub().PutState("md", metaDataJson)
+	putState(ctx, metaDataObjectType, metaDataId, metaDataJson)
 	community.Users = append(community.Users, creator)
 	existingUser.Communities = append(existingUser.Communities, id)
 	communityJson, _ := json.Marshal(community)
-	ctx.GetStub().PutState(id, communityJson)
+	putState(ctx, communityObjectType, id, communityJson)
 	UserJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(creator, UserJson)
-	return nil
+	putState(ctx, userObjectType, creator, UserJson)
+	err = logModActions(ctx, id, ModLogEntry{Action: ModActionAddModerator, Moderator: creator, TargetUser: creator})
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, CommunityCreatedEvent, community)
+	if err != nil {
+		return nil, err
+	}
+	return &community, nil
 
 }
 
@@ -576,7 +836,7 @@ Used to retrieve information about a community from blockchain.
 It takes the community's Id as a parameter and retrieves the community's data from the blockchain.
 */
 func (s *SmartContract) GetCommunity(ctx contractapi.TransactionContextInterface, id string) (*Community, error) {
-	communityJson, err := ctx.GetStub().GetState(id)
+	communityJson, err := getState(ctx, communityObjectType, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read community from ledger: %w", err)
 	}
@@ -594,9 +854,14 @@ func (s *SmartContract) GetCommunity(ctx contractapi.TransactionContextInterface
 
 /*
 Used to allow a user to join a specific community.
-It takes the user's Id and the community's Id as parameters and adds the user to the list of community members
+It takes the user's Id and the community's Id as parameters and adds the user to the list of community members.
+Only public communities can be joined directly; restricted and private communities take a join request, see RequestToJoin.
 */
 func (s *SmartContract) JoinCommunity(ctx contractapi.TransactionContextInterface, communityId string, userId string) (*UserModified, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
 	existingCommunity, err := s.GetCommunity(ctx, communityId)
 	if err != nil {
 		return nil, err
@@ -604,19 +869,24 @@ func (s *SmartContract) JoinCommunity(ctx contractapi.TransactionContextInterfac
 	if existingCommunity == nil {
 		return nil, fmt.Errorf("Community with ID %s doesn't exists", communityId)
 	}
-	existingCommunity.Users = append(existingCommunity.Users, userId)
-	communityJson, _ := json.Marshal(existingCommunity)
-	ctx.GetStub().PutState(communityId, communityJson)
-	currentUser, err := s.GetUser(ctx, userId)
+	if contains(existingCommunity.Users, userId) {
+		return nil, fmt.Errorf("User with ID %s is already a member of community %s", userId, communityId)
+	}
+	err = s.checkNotBanned(ctx, communityId, userId)
 	if err != nil {
 		return nil, err
 	}
-	if currentUser == nil {
-		return nil, fmt.Errorf("user with ID %s doesn't exists", userId)
+	if communityVisibility(existingCommunity) != CommunityPublic {
+		return nil, fmt.Errorf("Community %s is %s, request to join it instead", communityId, communityVisibility(existingCommunity))
+	}
+	err = s.addMember(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, CommunityJoinedEvent, MembershipEventPayload{CommunityId: communityId, UserId: userId})
+	if err != nil {
+		return nil, err
 	}
-	currentUser.Communities = append(currentUser.Communities, communityId)
-	userJson, _ := json.Marshal(currentUser)
-	ctx.GetStub().PutState(userId, userJson)
 	user, err := s.GetUserModified(ctx, userId)
 	if err != nil {
 		return nil, err
@@ -626,9 +896,14 @@ func (s *SmartContract) JoinCommunity(ctx contractapi.TransactionContextInterfac
 
 /*
 Used to allow a user to leave a specific community.
-It takes the user's Id and the community's Id as parameters and removes the user to the list of community members
+It takes the user's Id and the community's Id as parameters and removes the user to the list of community members.
+Users who aren't members, including users banned from the community, can't leave it.
 */
 func (s *SmartContract) UnJoinCommunity(ctx contractapi.TransactionContextInterface, communityId string, userId string) (bool, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return false, err
+	}
 	existingCommunity, err := s.GetCommunity(ctx, communityId)
 	if err != nil {
 		return false, err
@@ -636,9 +911,13 @@ func (s *SmartContract) UnJoinCommunity(ctx contractapi.TransactionContextInterf
 	if existingCommunity == nil {
 		return false, fmt.Errorf("Community with ID %s doesn't exists", communityId)
 	}
-	existingCommunity.Users = removeElement(existingCommunity.Users, findIndex(existingCommunity.Users, userId))
+	index := findIndex(existingCommunity.Users, userId)
+	if index == -1 {
+		return false, fmt.Errorf("User with ID %s is not a member of community %s", userId, communityId)
+	}
+	existingCommunity.Users = removeElement(existingCommunity.Users, index)
 	communityJson, _ := json.Marshal(existingCommunity)
-	ctx.GetStub().PutState(communityId, communityJson)
+	putState(ctx, communityObjectType, communityId, communityJson)
 	currentUser, err := s.GetUser(ctx, userId)
 	if err != nil {
 		return false, err
@@ -646,40 +925,81 @@ func (s *SmartContract) UnJoinCommunity(ctx contractapi.TransactionContextInterf
 	if currentUser == nil {
 		return false, fmt.Errorf("user with ID %s doesn't exists", userId)
 	}
-	currentUser.Communities = removeElement(currentUser.Communities, findIndex(currentUser.Communities, communityId))
-	userJson, _ := json.Marshal(currentUser)
-	ctx.GetStub().PutState(userId, userJson)
+	if index := findIndex(currentUser.Communities, communityId); index != -1 {
+		currentUser.Communities = removeElement(currentUser.Communities, index)
+		userJson, _ := json.Marshal(currentUser)
+		putState(ctx, userObjectType, userId, userJson)
+	}
+	err = emitEvent(ctx, CommunityLeftEvent, MembershipEventPayload{CommunityId: communityId, UserId: userId})
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
 /*
 Helps users to create posts within a specific community.
-It takes various parameters like post's title, content, author,creation timestamp, community Id, post Id.
+It takes various parameters like post's title, content, author and community Id.
+The post's Id and creation timestamp are derived from the transaction, and the created post is returned.
 This function ensures that the post is associated with the relevant community and user, adding the post's Id to their respective lists.
+The optional flair Id must name a flair from the community's catalog.
+*/
+func (s *SmartContract) CreatePost(ctx contractapi.TransactionContextInterface, communityId string, title string, content string, author string, flairId string) (*Post, error) {
+	return s.createPost(ctx, communityId, title, content, author, flairId, nil)
+}
+
+/*
+Creates a text post, or a poll post when poll is set, and indexes it in its community and under its author.
 */
-func (s *SmartContract) CreatePost(ctx contractapi.TransactionContextInterface, id string, createdAt string, communityId string, title string, content string, author string) error {
+func (s *SmartContract) createPost(ctx contractapi.TransactionContextInterface, communityId string, title string, content string, author string, flairId string, poll *Poll) (*Post, error) {
+	err := authorizeCaller(ctx, author)
+	if err != nil {
+		return nil, err
+	}
+	id := newEntityId(ctx, "p")
 	existingCommunity, err := s.GetCommunity(ctx, communityId)
 	fmt.Println(existingCommunity)
 	fmt.Println(err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if existingCommunity == nil {
-		return fmt.Errorf("Community with ID %s doesn't exists", communityId)
+		return nil, fmt.Errorf("Community with ID %s doesn't exists", communityId)
+	}
+	if flairId != "" && findFlair(existingCommunity.Flairs, flairId) == -1 {
+		return nil, fmt.Errorf("Flair with ID %s doesn't exists in community %s", flairId, communityId)
 	}
 	existingPost, err := s.GetPost(ctx, id)
 	if err == nil && existingPost != nil {
-		return fmt.Errorf("Post with ID %s already exists", id)
+		return nil, fmt.Errorf("Post with ID %s already exists", id)
 	}
 	existingUser, err := s.GetUser(ctx, author)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if existingUser == nil {
-		return fmt.Errorf("User with ID %s doesn't exists", author)
+		return nil, fmt.Errorf("User with ID %s doesn't exists", author)
+	}
+	err = s.checkNotBanned(ctx, existingCommunity.ID, author)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityPostable(existingCommunity, author)
+	if err != nil {
+		return nil, err
+	}
+	newPostType := PostTypeText
+	if poll != nil {
+		newPostType = PostTypePoll
+	}
+	err = s.checkPostRequirements(ctx, existingCommunity, existingUser, newPostType, title, content)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
 	}
-	layout := "2006-01-02T15:04:05.000Z"
-	currentTime, _ := time.Parse(layout, createdAt)
 	post := Post{
 		ID:        id,
 		Title:     title,
@@ -692,20 +1012,33 @@ func (s *SmartContract) CreatePost(ctx contractapi.TransactionContextInterface,
 		Community: communityId,
 		HideCount: 0,
 		ShowCount: 0,
-		UpVote:    make([]string, 0),
-		DownVote:  make([]string, 0),
 		HideVote:  make([]string, 0),
 		ShowVote:  make([]string, 0),
+		Flair:     flairId,
+		Type:      newPostType,
+		Poll:      poll,
 	}
 	existingCommunity.Posts = append(existingCommunity.Posts, id)
 	existingUser.Posts = append(existingUser.Posts, id)
 	communityJson, _ := json.Marshal(existingCommunity)
-	ctx.GetStub().PutState(communityId, communityJson)
+	putState(ctx, communityObjectType, communityId, communityJson)
 	userJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(author, userJson)
+	putState(ctx, userObjectType, author, userJson)
 	postJson, _ := json.Marshal(post)
-	ctx.GetStub().PutState(id, postJson)
-	return nil
+	putState(ctx, postObjectType, id, postJson)
+	err = putIndexEntry(ctx, communityPostIndex, communityId, currentTime, id)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, authorPostIndex, author, currentTime, id)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, PostCreatedEvent, post)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
 }
 
 /*
@@ -713,7 +1046,7 @@ Used to retrieve information about a post from blockchain.
 It takes the post's Id as a parameter and retrieves the post's data from the blockchain.
 */
 func (s *SmartContract) GetPost(ctx contractapi.TransactionContextInterface, id string) (*Post, error) {
-	postJson, err := ctx.GetStub().GetState(id)
+	postJson, err := getState(ctx, postObjectType, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read post from ledger: %w", err)
 	}
@@ -730,7 +1063,7 @@ func (s *SmartContract) GetPost(ctx contractapi.TransactionContextInterface, id
 }
 
 func (s *SmartContract) GetPostModified(ctx contractapi.TransactionContextInterface, postId string, userId string) (*PostModified, error) {
-	postJson, err := ctx.GetStub().GetState(postId)
+	postJson, err := getState(ctx, postObjectType, postId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read post from ledger: %w", err)
 	}
@@ -743,6 +1076,14 @@ func (s *SmartContract) GetPostModified(ctx contractapi.TransactionContextInterf
 	if err != nil {
 		return nil, err
 	}
+	existingCommunity, err := s.GetCommunity(ctx, post.Community)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
 	var postModified *PostModified
 	postModified, err = s.convertToPostModified(ctx, &post, userId)
 	if err != nil {
@@ -757,114 +1098,30 @@ When a user upvotes a post or comment, it increases the item's score.
 The function also manages the reputation system by incrementing the author's reputation score if the user is not the author.
 */
 func (s *SmartContract) UpVotePost(ctx contractapi.TransactionContextInterface, postId string, userId string) (bool, error) {
-	var author string
-	var upVotedDiff = 0
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingPost == nil {
-			return false, fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		if !contains(existingPost.UpVote, userId) {
-			existingPost.Score += 1
-			upVotedDiff += 1
-			existingPost.UpVote = append(existingPost.UpVote, userId)
-			if contains(existingPost.DownVote, userId) {
-				existingPost.DownVote = removeElement(existingPost.DownVote, findIndex(existingPost.DownVote, userId))
-				existingPost.Score += 1
-				upVotedDiff += 1
-			}
-		}
-		postJson, _ := json.Marshal(existingPost)
-		author = existingPost.Author
-		ctx.GetStub().PutState(postId, postJson)
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingComment == nil {
-			return false, fmt.Errorf("Comment with ID %s doesn't exists", postId)
-		}
-		if !contains(existingComment.UpVote, userId) {
-			existingComment.Score += 1
-			upVotedDiff += 1
-			existingComment.UpVote = append(existingComment.UpVote, userId)
-			if contains(existingComment.DownVote, userId) {
-				existingComment.DownVote = removeElement(existingComment.DownVote, findIndex(existingComment.DownVote, userId))
-				existingComment.Score += 1
-				upVotedDiff += 1
-			}
-		}
-		commentJson, _ := json.Marshal(existingComment)
-		author = existingComment.Author
-		ctx.GetStub().PutState(postId, commentJson)
-	}
-	existingUser, err := s.GetUser(ctx, author)
+	err := authorizeCaller(ctx, userId)
 	if err != nil {
 		return false, err
 	}
-	if existingUser == nil {
-		return false, fmt.Errorf("User with ID %s doesn't exists", userId)
+	err = s.checkItemBan(ctx, postId, userId)
+	if err != nil {
+		return false, err
 	}
-	if author != userId {
-		existingUser.Reputation += upVotedDiff
+	upVotedDiff, err := s.updateVote(ctx, postId, userId, 1, false)
+	if err != nil {
+		return false, err
 	}
-	userJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(author, userJson)
 	return upVotedDiff > 0, nil
 }
 
 func (s *SmartContract) UndoUpVotePost(ctx contractapi.TransactionContextInterface, postId string, userId string) (bool, error) {
-	var author string
-	var upVotedDiff = 0
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingPost == nil {
-			return false, fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		if contains(existingPost.UpVote, userId) {
-			existingPost.Score -= 1
-			upVotedDiff -= 1
-			existingPost.UpVote = removeElement(existingPost.UpVote, findIndex(existingPost.UpVote, userId))
-		}
-		postJson, _ := json.Marshal(existingPost)
-		author = existingPost.Author
-		ctx.GetStub().PutState(postId, postJson)
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingComment == nil {
-			return false, fmt.Errorf("Comment with ID %s doesn't exists", postId)
-		}
-		if contains(existingComment.UpVote, userId) {
-			existingComment.Score -= 1
-			upVotedDiff -= 1
-			existingComment.UpVote = removeElement(existingComment.UpVote, findIndex(existingComment.UpVote, userId))
-		}
-		commentJson, _ := json.Marshal(existingComment)
-		author = existingComment.Author
-		ctx.GetStub().PutState(postId, commentJson)
-	}
-	existingUser, err := s.GetUser(ctx, author)
+	err := authorizeCaller(ctx, userId)
 	if err != nil {
 		return false, err
 	}
-	if existingUser == nil {
-		return false, fmt.Errorf("User with ID %s doesn't exists", userId)
-	}
-	if author != userId {
-		existingUser.Reputation += upVotedDiff
+	upVotedDiff, err := s.updateVote(ctx, postId, userId, 1, true)
+	if err != nil {
+		return false, err
 	}
-	userJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(author, userJson)
 	return upVotedDiff < 0, nil
 }
 
@@ -874,117 +1131,197 @@ When a user downvotes a post or comment, it decreases the item's score.
 The function also manages the reputation system by decreamenting the author's reputation score if the user is not the author.
 */
 func (s *SmartContract) DownVotePost(ctx contractapi.TransactionContextInterface, postId string, userId string) (bool, error) {
-	var author string
-	var downVotedDiff = 0
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingPost == nil {
-			return false, fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		if !contains(existingPost.DownVote, userId) {
-			existingPost.Score -= 1
-			downVotedDiff -= 1
-			existingPost.DownVote = append(existingPost.DownVote, userId)
-			if contains(existingPost.UpVote, userId) {
-				existingPost.UpVote = removeElement(existingPost.UpVote, findIndex(existingPost.UpVote, userId))
-				existingPost.Score -= 1
-				downVotedDiff -= 1
-			}
-		}
-		// existingPost.Score -= 1
-		postJson, _ := json.Marshal(existingPost)
-		author = existingPost.Author
-		ctx.GetStub().PutState(postId, postJson)
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingComment == nil {
-			return false, fmt.Errorf("Comment with ID %s doesn't exists", postId)
-		}
-		if !contains(existingComment.DownVote, userId) {
-			existingComment.Score -= 1
-			downVotedDiff -= 1
-			existingComment.DownVote = append(existingComment.DownVote, userId)
-			if contains(existingComment.UpVote, userId) {
-				existingComment.UpVote = removeElement(existingComment.UpVote, findIndex(existingComment.UpVote, userId))
-				existingComment.Score -= 1
-				downVotedDiff -= 1
-			}
-		}
-		commentJson, _ := json.Marshal(existingComment)
-		author = existingComment.Author
-		ctx.GetStub().PutState(postId, commentJson)
-	}
-	existingUser, err := s.GetUser(ctx, author)
+	err := authorizeCaller(ctx, userId)
 	if err != nil {
 		return false, err
 	}
-	if existingUser == nil {
-		return false, fmt.Errorf("User with ID %s doesn't exists", userId)
+	err = s.checkItemBan(ctx, postId, userId)
+	if err != nil {
+		return false, err
 	}
-	if author != userId {
-		existingUser.Reputation += downVotedDiff
+	downVotedDiff, err := s.updateVote(ctx, postId, userId, -1, false)
+	if err != nil {
+		return false, err
 	}
-	userJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(author, userJson)
 	return downVotedDiff < 0, nil
 }
 
 func (s *SmartContract) UndoDownVotePost(ctx contractapi.TransactionContextInterface, postId string, userId string) (bool, error) {
-	var author string
-	var downVotedDiff = 0
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return false, err
-		}
-		if existingPost == nil {
-			return false, fmt.Errorf("Post with ID %s doesn't exists", postId)
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	downVotedDiff, err := s.updateVote(ctx, postId, userId, -1, true)
+	if err != nil {
+		return false, err
+	}
+	return downVotedDiff > 0, nil
+}
+
+/*
+Moves a user's vote on a post or comment towards the given direction (1 for upvote, -1 for downvote), or clears it when undo is set.
+The vote lives under its own (item, voter) key and the resulting score and reputation changes are written as delta keys,
+so the post, comment and author records are never rewritten and concurrent voters don't conflict with each other.
+Returns the change applied to the item's score.
+*/
+func (s *SmartContract) updateVote(ctx contractapi.TransactionContextInterface, itemId string, userId string, direction int, undo bool) (int, error) {
+	itemId, err := s.resolvePostId(ctx, itemId)
+	if err != nil {
+		return 0, err
+	}
+	author, err := s.getItemAuthor(ctx, itemId)
+	if err != nil {
+		return 0, err
+	}
+	current, err := s.getVote(ctx, itemId, userId)
+	if err != nil {
+		return 0, err
+	}
+	target := direction
+	if undo {
+		if current != direction {
+			return 0, nil
 		}
-		if contains(existingPost.DownVote, userId) {
-			existingPost.Score += 1
-			downVotedDiff += 1
-			existingPost.DownVote = removeElement(existingPost.DownVote, findIndex(existingPost.DownVote, userId))
+		target = 0
+	}
+	diff := target - current
+	if diff == 0 {
+		return 0, nil
+	}
+	err = s.setVote(ctx, itemId, userId, target)
+	if err != nil {
+		return 0, err
+	}
+	err = putDelta(ctx, scoreDeltaObjectType, itemId, diff)
+	if err != nil {
+		return 0, err
+	}
+	if author != userId {
+		err = putDelta(ctx, reputationDeltaObjectType, author, diff)
+		if err != nil {
+			return 0, err
 		}
-		// existingPost.Score -= 1
-		postJson, _ := json.Marshal(existingPost)
-		author = existingPost.Author
-		ctx.GetStub().PutState(postId, postJson)
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
+	}
+	err = emitEvent(ctx, VoteCastEvent, VoteEventPayload{ItemId: itemId, Voter: userId, Direction: target, ScoreDelta: diff})
+	if err != nil {
+		return 0, err
+	}
+	return diff, nil
+}
+
+func (s *SmartContract) getItemAuthor(ctx contractapi.TransactionContextInterface, itemId string) (string, error) {
+	itemType, err := s.getItemType(ctx, itemId)
+	if err != nil {
+		return "", err
+	}
+	if itemType == postObjectType {
+		existingPost, err := s.GetPost(ctx, itemId)
 		if err != nil {
-			return false, err
+			return "", err
 		}
-		if existingComment == nil {
-			return false, fmt.Errorf("Comment with ID %s doesn't exists", postId)
+		return existingPost.Author, nil
+	}
+	existingComment, err := s.GetComment(ctx, itemId)
+	if err != nil {
+		return "", err
+	}
+	return existingComment.Author, nil
+}
+
+/*
+Returns the direction of a user's vote on a post or comment: 1 for upvote, -1 for downvote and 0 if the user hasn't voted.
+*/
+func (s *SmartContract) getVote(ctx contractapi.TransactionContextInterface, itemId string, userId string) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(voteObjectType, []string{itemId, userId})
+	if err != nil {
+		return 0, err
+	}
+	voteJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read vote from ledger: %w", err)
+	}
+	if voteJson == nil {
+		return 0, nil
+	}
+	var vote Vote
+	err = json.Unmarshal(voteJson, &vote)
+	if err != nil {
+		return 0, err
+	}
+	return vote.Direction, nil
+}
+
+func (s *SmartContract) setVote(ctx contractapi.TransactionContextInterface, itemId string, userId string, direction int) error {
+	key, err := ctx.GetStub().CreateCompositeKey(voteObjectType, []string{itemId, userId})
+	if err != nil {
+		return err
+	}
+	if direction == 0 {
+		return ctx.GetStub().DelState(key)
+	}
+	vote := Vote{
+		Item:      itemId,
+		Voter:     userId,
+		Direction: direction,
+	}
+	voteJson, _ := json.Marshal(vote)
+	return ctx.GetStub().PutState(key, voteJson)
+}
+
+/*
+Records a change to an aggregated value (score or reputation) as its own key, suffixed by the transaction Id.
+Deltas are summed on read by sumDeltas, so writers never touch the same key.
+*/
+func putDelta(ctx contractapi.TransactionContextInterface, objectType string, id string, delta int) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{id, ctx.GetStub().GetTxID()})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(strconv.Itoa(delta)))
+}
+
+func sumDeltas(ctx contractapi.TransactionContextInterface, objectType string, id string) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{id})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	total := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
 		}
-		if contains(existingComment.DownVote, userId) {
-			existingComment.Score += 1
-			downVotedDiff += 1
-			existingComment.DownVote = removeElement(existingComment.DownVote, findIndex(existingComment.DownVote, userId))
+		delta, err := strconv.Atoi(string(queryResponse.Value))
+		if err != nil {
+			return 0, err
 		}
-		commentJson, _ := json.Marshal(existingComment)
-		author = existingComment.Author
-		ctx.GetStub().PutState(postId, commentJson)
+		total += delta
 	}
-	existingUser, err := s.GetUser(ctx, author)
+	return total, nil
+}
+
+/*
+Returns the effective score of a post or comment: the score stored on the item plus every vote delta recorded against it.
+*/
+func (s *SmartContract) getScore(ctx contractapi.TransactionContextInterface, itemId string, baseScore int) (int, error) {
+	delta, err := sumDeltas(ctx, scoreDeltaObjectType, itemId)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	if existingUser == nil {
-		return false, fmt.Errorf("User with ID %s doesn't exists", userId)
-	}
-	if author != userId {
-		existingUser.Reputation += downVotedDiff
+	return baseScore + delta, nil
+}
+
+/*
+Returns the effective reputation of a user: the reputation stored on the user plus every reputation delta earned from votes.
+*/
+func (s *SmartContract) getReputation(ctx contractapi.TransactionContextInterface, user *User) (int, error) {
+	delta, err := sumDeltas(ctx, reputationDeltaObjectType, user.ID)
+	if err != nil {
+		return 0, err
 	}
-	userJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(author, userJson)
-	return downVotedDiff > 0, nil
+	return user.Reputation + delta, nil
 }
 
 /*
@@ -993,7 +1330,7 @@ It takes the cpmment's Id as a parameter and retrieves the comment's data from t
 */
 
 func (s *SmartContract) GetComment(ctx contractapi.TransactionContextInterface, id string) (*Comment, error) {
-	commentJson, err := ctx.GetStub().GetState(id)
+	commentJson, err := getState(ctx, commentObjectType, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read community from ledger: %w", err)
 	}
@@ -1010,7 +1347,7 @@ func (s *SmartContract) GetComment(ctx contractapi.TransactionContextInterface,
 }
 
 func (s *SmartContract) GetCommentModified(ctx contractapi.TransactionContextInterface, commentId string, userId string) (*CommentModified, error) {
-	commentJson, err := ctx.GetStub().GetState(commentId)
+	commentJson, err := getState(ctx, commentObjectType, commentId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read community from ledger: %w", err)
 	}
@@ -1023,6 +1360,14 @@ func (s *SmartContract) GetCommentModified(ctx contractapi.TransactionContextInt
 	if err != nil {
 		return nil, err
 	}
+	existingCommunity, err := s.GetCommunity(ctx, comment.Community)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
 	var commentModified *CommentModified
 	commentModified, err = s.convertToCommentModified(ctx, &comment, userId)
 	if err != nil {
@@ -1032,53 +1377,88 @@ func (s *SmartContract) GetCommentModified(ctx contractapi.TransactionContextInt
 }
 
 /*
-Used to create comments on blockchain. It takes various parameters like  content, author,creation timestamp, comment Id, parent Id.
+Used to create comments on blockchain. It takes various parameters like content, author and parent Id.
+The comment's Id and creation timestamp are derived from the transaction, and the created comment is returned.
 It ensures that comments are associated with their parent posts or comments, by adding comment id in comments or replies of parent post or comment respectively.
 */
-func (s *SmartContract) CreateComment(ctx contractapi.TransactionContextInterface, commentId string, createdAt string, parentId string, content string, author string) error {
+func (s *SmartContract) CreateComment(ctx contractapi.TransactionContextInterface, parentId string, content string, author string) (*Comment, error) {
+	err := authorizeCaller(ctx, author)
+	if err != nil {
+		return nil, err
+	}
+	parentId, err = s.resolvePostId(ctx, parentId)
+	if err != nil {
+		return nil, err
+	}
+	commentId := newEntityId(ctx, "c")
 	existingComment, err := s.GetComment(ctx, commentId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err == nil && existingComment != nil {
-		return fmt.Errorf("Comment with ID %s already exists", commentId)
+		return nil, fmt.Errorf("Comment with ID %s already exists", commentId)
 	}
 	existingUser, err := s.GetUser(ctx, author)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if existingUser == nil {
-		return fmt.Errorf("User with ID %s doesn't exists", author)
+		return nil, fmt.Errorf("User with ID %s doesn't exists", author)
 	}
 	var communityId string
-	if parentId[0] == 'p' { //If parent is post
+	var parentAuthor string
+	parentType, err := s.getItemType(ctx, parentId)
+	if err != nil {
+		return nil, err
+	}
+	if parentType == postObjectType { //If parent is post
 		existingPost, err := s.GetPost(ctx, parentId)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if existingPost == nil {
-			return fmt.Errorf("Post with ID %s doesn't exists", parentId)
+			return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
 		}
 		existingPost.Comments = append(existingPost.Comments, commentId)
 		communityId = existingPost.Community
+		parentAuthor = existingPost.Author
 		postJson, _ := json.Marshal(existingPost)
-		ctx.GetStub().PutState(parentId, postJson)
+		putState(ctx, postObjectType, parentId, postJson)
 	} else { //If parent is comment
 		existingComment, err := s.GetComment(ctx, parentId)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if existingComment == nil {
-			return fmt.Errorf("Comment with ID %s doesn't exists", parentId)
+			return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
 		}
 		existingComment.Replies = append(existingComment.Replies, commentId)
 		communityId = existingComment.Community
+		parentAuthor = existingComment.Author
 		commentJson, _ := json.Marshal(existingComment)
-		ctx.GetStub().PutState(parentId, commentJson)
+		putState(ctx, commentObjectType, parentId, commentJson)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkNotBanned(ctx, existingCommunity.ID, author)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityPostable(existingCommunity, author)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommentRequirements(existingCommunity, content)
+	if err != nil {
+		return nil, err
 	}
 
-	layout := "2006-01-02T15:04:05.000Z"
-	currentTime, _ := time.Parse(layout, createdAt)
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
 	comment := Comment{
 		ID:        commentId,
 		Content:   content,
@@ -1091,33 +1471,60 @@ func (s *SmartContract) CreateComment(ctx contractapi.TransactionContextInterfac
 		Community: communityId,
 		HideCount: 0,
 		ShowCount: 0,
-		UpVote:    make([]string, 0),
-		DownVote:  make([]string, 0),
 		HideVote:  make([]string, 0),
 		ShowVote:  make([]string, 0),
 	}
 	existingUser.Comments = append(existingUser.Comments, commentId)
 	commentJson, _ := json.Marshal(comment)
-	ctx.GetStub().PutState(commentId, commentJson)
+	putState(ctx, commentObjectType, commentId, commentJson)
 	userJson, _ := json.Marshal(existingUser)
-	ctx.GetStub().PutState(author, userJson)
-	return nil
+	putState(ctx, userObjectType, author, userJson)
+	err = putIndexEntry(ctx, childCommentIndex, parentId, currentTime, commentId)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, authorCommentIndex, author, currentTime, commentId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.notify(ctx, parentAuthor, NotificationReply, author, commentId, commentObjectType, communityId, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, CommentCreatedEvent, comment)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
 }
 
-/*
-Generates a personalized feed for a user. It takes user Id and page No as parameters.
-It compiles posts from the user's joined communities, filtering out any hidden posts based on community moderation, and sorts them by timestamp in reverse chronological order.
-Uses pagination for managing large feeds.
-*/
 func (s *SmartContract) convertToPostModified(ctx contractapi.TransactionContextInterface, original *Post, userId string) (*PostModified, error) {
 
+	// A cross-post shows the content, votes and comments of the post it shares
+	content := original
+	var originalCommunity *Community
+	if original.CrossPostOf != "" {
+		sharedPost, err := s.GetPost(ctx, original.CrossPostOf)
+		if err != nil {
+			return nil, err
+		}
+		if sharedPost == nil {
+			return nil, fmt.Errorf("Post with ID %s doesn't exists", original.CrossPostOf)
+		}
+		content = sharedPost
+		originalCommunity, err = s.GetCommunity(ctx, content.Community)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a new PostModified instance
-	existingAuthor, err := s.GetUser(ctx, original.Author)
+	existingAuthor, err := s.GetUser(ctx, content.Author)
 	if err != nil {
 		return nil, err
 	}
 	if existingAuthor == nil {
-		return nil, fmt.Errorf("User with ID %s doesn't exists", original.Author)
+		return nil, fmt.Errorf("User with ID %s doesn't exists", content.Author)
 	}
 	existingCommunity, err := s.GetCommunity(ctx, original.Community)
 	if err != nil {
@@ -1130,25 +1537,53 @@ func (s *SmartContract) convertToPostModified(ctx contractapi.TransactionContext
 	if err != nil {
 		return nil, err
 	}
+	score, err := s.getScore(ctx, content.ID, content.Score)
+	if err != nil {
+		return nil, err
+	}
+	vote, err := s.getVote(ctx, content.ID, userId)
+	if err != nil {
+		return nil, err
+	}
+	var pollResults *PollResults
+	if content.Poll != nil {
+		pollResults, err = s.tallyPoll(ctx, content, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
 	modified := PostModified{
 		ID:            original.ID,
-		Title:         original.Title,
-		Content:       original.Content,
-		Author:        original.Author,
-		Score:         original.Score,
+		Title:         content.Title,
+		Content:       content.Content,
+		Author:        content.Author,
+		Score:         score,
 		CreatedAt:     original.CreatedAt,
-		Comments:      original.Comments,
+		Comments:      content.Comments,
 		Hidden:        original.Hidden,
 		Community:     original.Community,
 		HideCount:     original.HideCount,
 		ShowCount:     original.ShowCount,
 		AuthorName:    existingAuthor.Username, // Set your desired value for AuthorName
 		CommunityName: existingCommunity.Name,  // Set your desired value for CommunityName
-		HasUpvoted:    contains(original.UpVote, userId),
-		HasDownvoted:  contains(original.DownVote, userId),
+		HasUpvoted:    vote == 1,
+		HasDownvoted:  vote == -1,
 		IsAppealed:    val,
 		HasHideVoted:  contains(original.HideVote, userId),
 		HasShowVoted:  contains(original.ShowVote, userId),
+		Edited:        content.Revisions > 0,
+		EditedAt:      content.EditedAt,
+		Flair:         postFlair(original, existingCommunity),
+		Type:          postType(content),
+		Poll:          pollResults,
+		HiddenRule:    original.HiddenRule,
+		Case:          original.Case,
+	}
+	if originalCommunity != nil {
+		modified.CrossPostOf = original.CrossPostOf
+		modified.CrossPostedBy = original.Author
+		modified.OriginalCommunity = originalCommunity.ID
+		modified.OriginalCommunityName = originalCommunity.Name
 	}
 	fmt.Println(original)
 	return &modified, nil
@@ -1175,11 +1610,19 @@ func (s *SmartContract) convertToCommentModified(ctx contractapi.TransactionCont
 	if err != nil {
 		return nil, err
 	}
+	score, err := s.getScore(ctx, original.ID, original.Score)
+	if err != nil {
+		return nil, err
+	}
+	vote, err := s.getVote(ctx, original.ID, userId)
+	if err != nil {
+		return nil, err
+	}
 	modified := CommentModified{
 		ID:            original.ID,
 		Content:       original.Content,
 		Author:        original.Author,
-		Score:         original.Score,
+		Score:         score,
 		CreatedAt:     original.CreatedAt,
 		Replies:       original.Replies,
 		Hidden:        original.Hidden,
@@ -1188,12 +1631,16 @@ func (s *SmartContract) convertToCommentModified(ctx contractapi.TransactionCont
 		ShowCount:     original.ShowCount,
 		AuthorName:    existingAuthor.Username, // Set your desired value for AuthorName
 		CommunityName: existingCommunity.Name,  // Set your desired value for CommunityName
-		HasUpvoted:    contains(original.UpVote, userId),
-		HasDownvoted:  contains(original.DownVote, userId),
+		HasUpvoted:    vote == 1,
+		HasDownvoted:  vote == -1,
 		Parent:        original.Parent,
 		IsAppealed:    val,
 		HasHideVoted:  contains(original.HideVote, userId),
 		HasShowVoted:  contains(original.ShowVote, userId),
+		Edited:        original.Revisions > 0,
+		EditedAt:      original.EditedAt,
+		HiddenRule:    original.HiddenRule,
+		Case:          original.Case,
 	}
 	fmt.Println(original)
 	return &modified, nil
@@ -1216,11 +1663,25 @@ func (s *SmartContract) convertToUserModified(ctx contractapi.TransactionContext
 	// if existingAuthor == nil {
 	// 	return nil, fmt.Errorf("Community with ID %s doesn't exists", original.Community)
 	// }
+	reputation, err := s.getReputation(ctx, original)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := sumDeltas(ctx, followerDeltaObjectType, original.ID)
+	if err != nil {
+		return nil, err
+	}
+	following, err := sumDeltas(ctx, followingDeltaObjectType, original.ID)
+	if err != nil {
+		return nil, err
+	}
 	modified := UserModified{
 		ID:         original.ID,
-		Reputation: original.Reputation,
+		Reputation: reputation,
 		Email:      original.Email,
 		Username:   original.Username,
+		Followers:  followers,
+		Following:  following,
 	}
 	//fmt.Println(original)
 	return &modified, nil
@@ -1262,63 +1723,47 @@ func (s *SmartContract) convertToCommunityModified(ctx contractapi.TransactionCo
 		}
 		Moderators = append(Moderators, *userModified)
 	}
+	flairs := original.Flairs
+	if flairs == nil {
+		flairs = make([]Flair, 0)
+	}
+	rules := communityRules(original)
 	modified := CommunityModified{
-		ID:          original.ID,
-		Name:        original.Name,
-		Description: original.Description,
-		Creator:     original.Creator,
-		CreatedAt:   original.CreatedAt,
-		Moderators:  Moderators,
-		Users:       Users,
+		ID:                 original.ID,
+		Name:               original.Name,
+		Description:        original.Description,
+		Creator:            original.Creator,
+		CreatedAt:          original.CreatedAt,
+		Moderators:         Moderators,
+		Users:              Users,
+		Flairs:             flairs,
+		Rules:              rules.Rules,
+		Requirements:       rules.Requirements,
+		Visibility:         communityVisibility(original),
+		ModeratorSelection: moderatorSelection(original),
+		Election:           original.Election,
+		AppealThreshold:    appealThreshold(original),
+		CasePolicy:         casePolicy(original),
 	}
 	//fmt.Println(original)
 	return &modified, nil
 }
 
-func (s *SmartContract) GetUserFeed(ctx contractapi.TransactionContextInterface, userId string, pageNo int) ([]*PostModified, error) {
-	// var userFeed []*Post
-	// existingUser, err := s.GetUser(ctx, userId)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// if existingUser == nil {
-	// 	return nil, fmt.Errorf("User with ID %s doesn't exists", userId)
-	// }
-
-	// for _, community := range existingUser.Communities {
-	// 	communityPosts := []*Post{}
-	// 	existingCommunity, err := s.GetCommunity(ctx, community)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingCommunity == nil {
-	// 		return nil, fmt.Errorf("Community with ID %s doesn't exists", community)
-	// 	}
-	// 	for _, postId := range existingCommunity.Posts {
-	// 		post, err := s.GetPost(ctx, postId) // Function to get a post by ID
-	// 		if post.Hidden {
-	// 			continue
-	// 		}
-	// 		if err != nil {
-	// 			return nil, err
-	// 		}
-	// 		communityPosts = append(communityPosts, post)
-	// 	}
-
-	// 	// Add community posts to the user's feed
-	// 	userFeed = append(userFeed, communityPosts...)
-	// }
-
-	// // Sort the user's feed by timestamp (reverse chronological order)
-	// sort.Slice(userFeed, func(i, j int) bool {
-	// 	return userFeed[i].CreatedAt.After(userFeed[j].CreatedAt)
-	// })
-	// if len(userFeed) <= PostsPerPage*pageNo {
-	// 	return []*Post{}, nil
-	// }
-	// return userFeed[PostsPerPage*pageNo : min(PostsPerPage*(pageNo+1), len(userFeed))], nil
-	var userFeed []*Post
-	var userFeedModified []*PostModified
+/*
+Generates a personalized feed for a user. It takes user Id, a cursor, a sort order and a time window as parameters.
+It merges posts from the user's joined communities, filtering out any hidden posts based on community moderation.
+The "new" order (the default) is reverse chronological and is read page by page from the communities' time-ordered post indexes; an empty cursor starts at the newest post.
+The "hot", "top" and "controversial" orders are described in rankPost, and the window ("day", "week", "month" or "all") limits top and controversial.
+A non-empty flair keeps only posts whose flair has that text, in whichever community.
+A post cross-posted between the user's communities appears once, as described in dedupeCrossPosts.
+The "following" feed merges the posts of the users the user follows, across communities, instead of the communities' posts.
+The feed is personal, so only the user can read it, and posts of private communities the user can't read are left out of either feed.
+*/
+func (s *SmartContract) GetUserFeed(ctx contractapi.TransactionContextInterface, userId string, cursor string, sortBy string, window string, flair string, feed string) (*PostPage, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
 	existingUser, err := s.GetUser(ctx, userId)
 	if err != nil {
 		return nil, err
@@ -1326,333 +1771,132 @@ func (s *SmartContract) GetUserFeed(ctx contractapi.TransactionContextInterface,
 	if existingUser == nil {
 		return nil, fmt.Errorf("User with ID %s doesn't exist", userId)
 	}
-
-	// Create a map to store community posts and channels to wait for them
-	communityPosts := make(map[string][]*Post)
-	// var wg sync.WaitGroup
-	// var mu sync.Mutex // Mutex for synchronizing access to communityPosts
-	// for _, community := range existingUser.Communities {
-	// 	wg.Add(1)
-	// 	fmt.Println("inside go", community)
-	// 	go func(communityID string) {
-	// 		defer wg.Done()
-
-	// 		existingCommunity, err := s.GetCommunity(ctx, communityID)
-	// 		if err != nil {
-	// 			// Handle the error
-	// 			return
-	// 		}
-
-	// 		// Fetch posts in parallel
-	// 		posts := s.fetchCommunityPosts(ctx, existingCommunity.Posts)
-
-	// 		// Lock the mutex before updating the map
-	// 		mu.Lock()
-	// 		communityPosts[communityID] = posts
-	// 		mu.Unlock() // Unlock the mutex after updating the map
-	// 	}(community)
-	// }
-
-	// wg.Wait()
-	for _, community := range existingUser.Communities {
-		fmt.Println("inside sequential", community)
-
-		existingCommunity, err := s.GetCommunity(ctx, community)
+	indexType := communityPostIndex
+	ownerIds := existingUser.Communities
+	switch feed {
+	case "", FeedCommunities:
+	case FeedFollowing:
+		indexType = authorPostIndex
+		ownerIds, err = getFollowedIds(ctx, userId)
 		if err != nil {
-			// Handle the error
 			return nil, err
 		}
-
-		// Fetch posts sequentially
-		posts := s.fetchCommunityPosts(ctx, existingCommunity.Posts)
-
-		// Update the map
-		communityPosts[community] = posts
-	}
-	// Process community posts
-	// for _, community := range existingUser.Communities {
-	// 	userFeed = append(userFeed, communityPosts[community]...)
-	// 	fmt.Println("outside go", userFeed)
-	// }
-	for _, community := range existingUser.Communities {
-		// Ensure that the community exists in the map before appending
-		if posts, ok := communityPosts[community]; ok {
-			userFeed = append(userFeed, posts...)
-		}
+	default:
+		return nil, fmt.Errorf("Invalid feed %s", feed)
 	}
-	// Sort the user's feed by timestamp (reverse chronological order)
-	sort.Slice(userFeed, func(i, j int) bool {
-		return userFeed[i].CreatedAt.After(userFeed[j].CreatedAt)
-	})
-
-	// Calculate the range for pagination
-	start := pageNo * PostsPerPage
-	end := min((pageNo+1)*PostsPerPage, len(userFeed))
-
-	if start >= len(userFeed) {
-		return []*PostModified{}, nil
+	if sortBy != "" && sortBy != SortNew {
+		return s.rankedPostPage(ctx, indexType, ownerIds, userId, cursor, sortBy, window, flair)
 	}
-
-	for _, originalPost := range userFeed[start:end] {
-		modifiedPost, error := s.convertToPostModified(ctx, originalPost, userId)
-		if error != nil {
-			return nil, error
-		}
-		userFeedModified = append(userFeedModified, modifiedPost)
-	}
-	return userFeedModified, nil
-}
-
-func (s *SmartContract) fetchCommunityPosts(ctx contractapi.TransactionContextInterface, postIDs []string) []*Post {
-	communityPosts := []*Post{}
-	for _, postID := range postIDs {
-		post, err := s.GetPost(ctx, postID)
-		if err != nil {
-			// Handle the error
-			continue
-		}
-		if !post.Hidden {
-			communityPosts = append(communityPosts, post)
-		}
+	posts := make(map[string]*Post)
+	entries, err := scanIndexes(ctx, indexType, ownerIds, cursor, PostsPerPage+1, s.feedPosts(ctx, indexType, ownerIds, userId, flair, posts))
+	if err != nil {
+		return nil, err
 	}
-	return communityPosts
+	return s.postPage(ctx, entries, posts, userId)
 }
 
 /*
-Used fetching a feed of immediate level comments. It takes parent Id and page No as parameters.
+Used fetching a feed of immediate level comments. It takes parent Id and a cursor as parameters.
 It can either replies to a parent comment or comments on a post, in reverse chronological order.
 It ensures that hidden comments, as determined by community moderation, are excluded.
-Uses pagination for managing large feeds.
+Pages are read from the parent's time-ordered comment index; an empty cursor starts at the newest comment.
 */
-func (s *SmartContract) GetCommentFeed(ctx contractapi.TransactionContextInterface, parentId string, pageNo int, userId string) ([]*CommentModified, error) {
-	var commentFeed []*Comment
-	var commentFeedModified []*CommentModified
-	var commentList []string
-	if parentId[0] == 'p' { //If parent is post
+func (s *SmartContract) GetCommentFeed(ctx contractapi.TransactionContextInterface, parentId string, cursor string, userId string) (*CommentPage, error) {
+	parentType, err := s.getItemType(ctx, parentId)
+	if err != nil {
+		return nil, err
+	}
+	parentId, err = s.resolvePostId(ctx, parentId)
+	if err != nil {
+		return nil, err
+	}
+	var communityId string
+	if parentType == postObjectType {
 		existingPost, err := s.GetPost(ctx, parentId)
 		if err != nil {
 			return nil, err
 		}
-		if existingPost == nil {
-			return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
-		}
-		commentList = existingPost.Comments
-	} else { //If parent is comment
+		communityId = existingPost.Community
+	} else {
 		existingComment, err := s.GetComment(ctx, parentId)
 		if err != nil {
 			return nil, err
 		}
-		if existingComment == nil {
-			return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
-		}
-		commentList = existingComment.Replies
+		communityId = existingComment.Community
 	}
-	for i := len(commentList) - 1; i >= 0; i-- {
-		comment, err := s.GetComment(ctx, commentList[i]) // Function to get a post by ID
-		if comment.Hidden {
-			continue
-		}
-		if err != nil {
-			return nil, err
-		}
-		commentFeed = append(commentFeed, comment)
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
 	}
-	sort.Slice(commentFeed, func(i, j int) bool {
-		return commentFeed[i].CreatedAt.After(commentFeed[j].CreatedAt)
-	})
-	if len(commentFeed) <= CommentsPerPage*pageNo {
-		return []*CommentModified{}, nil
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
 	}
+	comments := make(map[string]*Comment)
+	entries, err := scanIndexes(ctx, childCommentIndex, []string{parentId}, cursor, CommentsPerPage+1, s.visibleComments(ctx, comments))
+	if err != nil {
+		return nil, err
+	}
+	return s.commentPage(ctx, entries, comments, userId)
+}
 
-	start := CommentsPerPage * pageNo
-	end := min(CommentsPerPage*(pageNo+1), len(commentFeed))
-	for _, originalComment := range commentFeed[start:end] {
-		modifiedComment, error := s.convertToCommentModified(ctx, originalComment, userId)
-		if error != nil {
-			return nil, error
-		}
-		commentFeedModified = append(commentFeedModified, modifiedComment)
-	}
-	return commentFeedModified, nil
-	// return commentFeed[CommentsPerPage*pageNo : min(CommentsPerPage*(pageNo+1), len(commentFeed))], nil
-
-}
-
-func (s *SmartContract) GetUserProfileComments(ctx contractapi.TransactionContextInterface, targetUserId string, userId string, pageNo int) ([]*CommentModified, error) {
-	var commentFeed []*Comment
-	var commentFeedModified []*CommentModified
-	var commentList []string
-	// if parentId[0] == 'p' { //If parent is post
-	// 	existingPost, err := s.GetPost(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingPost == nil {
-	// 		return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingPost.Comments
-	// } else { //If parent is comment
-	// 	existingComment, err := s.GetComment(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingComment == nil {
-	// 		return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingComment.Replies
-	// }
+/*
+Returns the visible comments of a user, newest first, leaving out comments in private communities the calling user can't read.
+Pages are read from the user's time-ordered comment index; an empty cursor starts at the newest comment.
+*/
+func (s *SmartContract) GetUserProfileComments(ctx contractapi.TransactionContextInterface, targetUserId string, userId string, cursor string) (*CommentPage, error) {
 	targetUser, err := s.GetUser(ctx, targetUserId)
-	commentList = targetUser.Comments
 	if err != nil {
 		return nil, err
 	}
-	for i := len(commentList) - 1; i >= 0; i-- {
-		comment, err := s.GetComment(ctx, commentList[i]) // Function to get a post by ID
-		if comment.Hidden {
-			continue
-		}
-		if err != nil {
-			return nil, err
-		}
-		commentFeed = append(commentFeed, comment)
+	if targetUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", targetUserId)
 	}
-	// sort.Slice(commentFeed, func(i, j int) bool {
-	// 	return commentFeed[i].CreatedAt.After(commentFeed[j].CreatedAt)
-	// })
-	if len(commentFeed) <= CommentsPerPage*pageNo {
-		return []*CommentModified{}, nil
+	comments := make(map[string]*Comment)
+	entries, err := scanIndexes(ctx, authorCommentIndex, []string{targetUserId}, cursor, CommentsPerPage+1, s.readableItems(ctx, userId, nil, comments, s.visibleComments(ctx, comments)))
+	if err != nil {
+		return nil, err
 	}
+	return s.commentPage(ctx, entries, comments, userId)
+}
 
-	start := CommentsPerPage * pageNo
-	end := min(CommentsPerPage*(pageNo+1), len(commentFeed))
-	for _, originalComment := range commentFeed[start:end] {
-		modifiedComment, error := s.convertToCommentModified(ctx, originalComment, userId)
-		if error != nil {
-			return nil, error
-		}
-		commentFeedModified = append(commentFeedModified, modifiedComment)
-	}
-	return commentFeedModified, nil
-	// return commentFeed[CommentsPerPage*pageNo : min(CommentsPerPage*(pageNo+1), len(commentFeed))], nil
-
-}
-
-func (s *SmartContract) GetUserProfilePosts(ctx contractapi.TransactionContextInterface, targetUserId string, userId string, pageNo int) ([]*PostModified, error) {
-	var postFeed []*Post
-	var postFeedModified []*PostModified
-	var postList []string
-	// if parentId[0] == 'p' { //If parent is post
-	// 	existingPost, err := s.GetPost(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingPost == nil {
-	// 		return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingPost.Comments
-	// } else { //If parent is comment
-	// 	existingComment, err := s.GetComment(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingComment == nil {
-	// 		return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingComment.Replies
-	// }
+func (s *SmartContract) GetUserProfilePosts(ctx contractapi.TransactionContextInterface, targetUserId string, userId string, cursor string) (*PostPage, error) {
 	targetUser, err := s.GetUser(ctx, targetUserId)
-	postList = targetUser.Posts
 	if err != nil {
 		return nil, err
 	}
-	for i := len(postList) - 1; i >= 0; i-- {
-		post, err := s.GetPost(ctx, postList[i]) // Function to get a post by ID
-		if post.Hidden {
-			continue
-		}
-		if err != nil {
-			return nil, err
-		}
-		postFeed = append(postFeed, post)
+	if targetUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", targetUserId)
 	}
-	// sort.Slice(commentFeed, func(i, j int) bool {
-	// 	return commentFeed[i].CreatedAt.After(commentFeed[j].CreatedAt)
-	// })
-	if len(postFeed) <= PostsPerPage*pageNo {
-		return []*PostModified{}, nil
+	posts := make(map[string]*Post)
+	entries, err := scanIndexes(ctx, authorPostIndex, []string{targetUserId}, cursor, PostsPerPage+1, s.readablePosts(ctx, userId, posts, s.visiblePosts(ctx, posts)))
+	if err != nil {
+		return nil, err
 	}
+	return s.postPage(ctx, entries, posts, userId)
+}
 
-	start := PostsPerPage * pageNo
-	end := min(PostsPerPage*(pageNo+1), len(postFeed))
-	for _, originalpost := range postFeed[start:end] {
-		modifiedpost, error := s.convertToPostModified(ctx, originalpost, userId)
-		if error != nil {
-			return nil, error
-		}
-		postFeedModified = append(postFeedModified, modifiedpost)
-	}
-	return postFeedModified, nil
-	// return commentFeed[CommentsPerPage*pageNo : min(CommentsPerPage*(pageNo+1), len(commentFeed))], nil
-
-}
-
-func (s *SmartContract) GetCommunityPosts(ctx contractapi.TransactionContextInterface, communityId string, userId string, pageNo int) ([]*PostModified, error) {
-	var postFeed []*Post
-	var postFeedModified []*PostModified
-	var postList []string
-	// if parentId[0] == 'p' { //If parent is post
-	// 	existingPost, err := s.GetPost(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingPost == nil {
-	// 		return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingPost.Comments
-	// } else { //If parent is comment
-	// 	existingComment, err := s.GetComment(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingComment == nil {
-	// 		return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingComment.Replies
-	// }
-	targetCommunity, err := s.GetCommunity(ctx, communityId)
-	postList = targetCommunity.Posts
+/*
+Returns the visible posts of a community, in the same sort orders and with the same parameters, including the flair filter, as GetUserFeed.
+*/
+func (s *SmartContract) GetCommunityPosts(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string, sortBy string, window string, flair string) (*PostPage, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
 	if err != nil {
 		return nil, err
 	}
-	for i := len(postList) - 1; i >= 0; i-- {
-		post, err := s.GetPost(ctx, postList[i]) // Function to get a post by ID
-		if post.Hidden {
-			continue
-		}
-		if err != nil {
-			return nil, err
-		}
-		postFeed = append(postFeed, post)
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
 	}
-	// sort.Slice(commentFeed, func(i, j int) bool {
-	// 	return commentFeed[i].CreatedAt.After(commentFeed[j].CreatedAt)
-	// })
-	if len(postFeed) <= PostsPerPage*pageNo {
-		return []*PostModified{}, nil
+	if sortBy != "" && sortBy != SortNew {
+		return s.rankedPostPage(ctx, communityPostIndex, []string{communityId}, userId, cursor, sortBy, window, flair)
 	}
-
-	start := PostsPerPage * pageNo
-	end := min(PostsPerPage*(pageNo+1), len(postFeed))
-	for _, originalpost := range postFeed[start:end] {
-		modifiedpost, error := s.convertToPostModified(ctx, originalpost, userId)
-		if error != nil {
-			return nil, error
-		}
-		postFeedModified = append(postFeedModified, modifiedpost)
+	posts := make(map[string]*Post)
+	entries, err := scanIndexes(ctx, communityPostIndex, []string{communityId}, cursor, PostsPerPage+1, s.feedPosts(ctx, communityPostIndex, []string{communityId}, userId, flair, posts))
+	if err != nil {
+		return nil, err
 	}
-	return postFeedModified, nil
-	// return commentFeed[CommentsPerPage*pageNo : min(CommentsPerPage*(pageNo+1), len(commentFeed))], nil
-
+	return s.postPage(ctx, entries, posts, userId)
 }
 
 type PostOrComment struct {
@@ -1660,146 +1904,36 @@ type PostOrComment struct {
 	Comment *CommentModified
 }
 
-func (s *SmartContract) GetCommunityAppealed(ctx contractapi.TransactionContextInterface, communityId string, userId string, pageNo int) ([]*PostOrComment, error) {
-	//var postFeed []*Post
-	var PostOrCommentArray []*PostOrComment
-	var postList []string
-	// if parentId[0] == 'p' { //If parent is post
-	// 	existingPost, err := s.GetPost(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingPost == nil {
-	// 		return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingPost.Comments
-	// } else { //If parent is comment
-	// 	existingComment, err := s.GetComment(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingComment == nil {
-	// 		return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingComment.Replies
-	// }
-	targetCommunity, err := s.GetCommunity(ctx, communityId)
-	postList = targetCommunity.Appealed
+/*
+Returns the visible comments of a community that have an open moderation case, newest case first.
+Pages are read from the community's time-ordered case list; an empty cursor starts at the newest case.
+*/
+func (s *SmartContract) GetCommunityAppealedComments(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string) (*CommentPage, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
 	if err != nil {
 		return nil, err
 	}
-	for i := len(postList) - 1; i >= 0; i-- {
-		if postList[i][0] == 'c' {
-			post, err := s.GetComment(ctx, postList[i]) // Function to get a post by ID
-			if post.Hidden {
-				continue
-			}
-			if err != nil {
-				return nil, err
-			}
-			// postFeed = append(postFeed, post)
-			modifiedpost, error := s.convertToCommentModified(ctx, post, userId)
-			if error != nil {
-				return nil, error
-			}
-			PostOrCommentArray = append(PostOrCommentArray, &PostOrComment{Comment: modifiedpost})
-		} else {
-			post, err := s.GetPost(ctx, postList[i]) // Function to get a post by ID
-			if post.Hidden {
-				continue
-			}
-			if err != nil {
-				return nil, err
-			}
-			// postFeed = append(postFeed, post)
-			modifiedpost, error := s.convertToPostModified(ctx, post, userId)
-			if error != nil {
-				return nil, error
-			}
-			PostOrCommentArray = append(PostOrCommentArray, &PostOrComment{Post: modifiedpost})
-		}
-	}
-	// sort.Slice(commentFeed, func(i, j int) bool {
-	// 	return commentFeed[i].CreatedAt.After(commentFeed[j].CreatedAt)
-	// })
-	if len(postList) <= PostsPerPage*pageNo {
-		return []*PostOrComment{}, nil
-	}
-
-	start := PostsPerPage * pageNo
-	end := min(PostsPerPage*(pageNo+1), len(postList))
-	// for _, originalpost := range postFeed[start:end] {
-	// 	modifiedpost, error := s.convertToPostModified(ctx, originalpost, userId)
-	// 	if error != nil {
-	// 		return nil, error
-	// 	}
-	// 	postFeedModified = append(postFeedModified, modifiedpost)
-	// }
-	return PostOrCommentArray[start:end], nil
-	// return commentFeed[CommentsPerPage*pageNo : min(CommentsPerPage*(pageNo+1), len(commentFeed))], nil
-
-}
-
-func (s *SmartContract) GetCommunityAppealedComments(ctx contractapi.TransactionContextInterface, communityId string, userId string, pageNo int) ([]*CommentModified, error) {
-	var postFeed []*Comment
-	var postFeedModified []*CommentModified
-	var postList []string
-	// if parentId[0] == 'p' { //If parent is post
-	// 	existingPost, err := s.GetPost(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingPost == nil {
-	// 		return nil, fmt.Errorf("Post with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingPost.Comments
-	// } else { //If parent is comment
-	// 	existingComment, err := s.GetComment(ctx, parentId)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if existingComment == nil {
-	// 		return nil, fmt.Errorf("Comment with ID %s doesn't exists", parentId)
-	// 	}
-	// 	commentList = existingComment.Replies
-	// }
-	targetCommunity, err := s.GetCommunity(ctx, communityId)
-	postList = targetCommunity.Appealed
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
 	if err != nil {
 		return nil, err
 	}
-	for i := len(postList) - 1; i >= 0; i-- {
-		if postList[i][0] == 'p' {
-			continue
-		}
-		post, err := s.GetComment(ctx, postList[i]) // Function to get a post by ID
-		if post.Hidden {
-			continue
-		}
-		if err != nil {
-			return nil, err
+	comments := make(map[string]*Comment)
+	entries, err := scanIndexes(ctx, caseIndex, []string{communityId}, cursor, CommentsPerPage+1, func(caseId string) (bool, error) {
+		moderationCase, err := s.getCase(ctx, caseId)
+		if err != nil || moderationCase == nil || moderationCase.State != CaseOpen || moderationCase.ItemType != commentObjectType {
+			return false, err
 		}
-		postFeed = append(postFeed, post)
-	}
-	// sort.Slice(commentFeed, func(i, j int) bool {
-	// 	return commentFeed[i].CreatedAt.After(commentFeed[j].CreatedAt)
-	// })
-	if len(postFeed) <= PostsPerPage*pageNo {
-		return []*CommentModified{}, nil
-	}
-
-	start := PostsPerPage * pageNo
-	end := min(PostsPerPage*(pageNo+1), len(postFeed))
-	for _, originalpost := range postFeed[start:end] {
-		modifiedpost, error := s.convertToCommentModified(ctx, originalpost, userId)
-		if error != nil {
-			return nil, error
+		comment, err := s.GetComment(ctx, moderationCase.ItemId)
+		if err != nil || comment == nil || comment.Hidden {
+			return false, err
 		}
-		postFeedModified = append(postFeedModified, modifiedpost)
+		comments[caseId] = comment
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return postFeedModified, nil
-	// return commentFeed[CommentsPerPage*pageNo : min(CommentsPerPage*(pageNo+1), len(commentFeed))], nil
-
+	return s.commentPage(ctx, entries, comments, userId)
 }
 
 /*
@@ -1807,7 +1941,15 @@ Enables users to hide their own posts or comments from public by setting the "Hi
 This function performs a verification step to ensure that the user attempting to delete the content is indeed the author, preventing unauthorized deletions.
 */
 func (s *SmartContract) DeletePost(ctx contractapi.TransactionContextInterface, postId string, userId string) error {
-	if postId[0] == 'p' {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	itemType, err := s.getItemType(ctx, postId)
+	if err != nil {
+		return err
+	}
+	if itemType == postObjectType {
 		existingPost, err := s.GetPost(ctx, postId)
 		if err != nil {
 			return err
@@ -1820,8 +1962,8 @@ func (s *SmartContract) DeletePost(ctx contractapi.TransactionContextInterface,
 		}
 		existingPost.Hidden = true
 		postJson, _ := json.Marshal(existingPost)
-		ctx.GetStub().PutState(postId, postJson)
-		return nil
+		putState(ctx, postObjectType, postId, postJson)
+		return emitEvent(ctx, ContentDeletedEvent, ContentEventPayload{ItemId: postId, ItemType: postObjectType, CommunityId: existingPost.Community, UserId: userId})
 	} else {
 		existingComment, err := s.GetComment(ctx, postId)
 		if err != nil {
@@ -1833,7 +1975,11 @@ func (s *SmartContract) DeletePost(ctx contractapi.TransactionContextInterface,
 		if userId != existingComment.Author {
 			return fmt.Errorf("User cannot delete comment with ID %s ", postId)
 		}
-		if existingComment.Parent[0] == 'p' {
+		parentType, err := s.getItemType(ctx, existingComment.Parent)
+		if err != nil {
+			return err
+		}
+		if parentType == postObjectType {
 			parentPost, err := s.GetPost(ctx, existingComment.Parent)
 			if err != nil {
 				return err
@@ -1843,7 +1989,7 @@ func (s *SmartContract) DeletePost(ctx contractapi.TransactionContextInterface,
 			}
 			parentPost.Comments = removeElement(parentPost.Comments, findIndex(parentPost.Comments, existingComment.ID))
 			parentPostJson, _ := json.Marshal(parentPost)
-			ctx.GetStub().PutState(existingComment.Parent, parentPostJson)
+			putState(ctx, postObjectType, existingComment.Parent, parentPostJson)
 
 		} else {
 			parentPost, err := s.GetComment(ctx, existingComment.Parent)
@@ -1855,74 +2001,22 @@ func (s *SmartContract) DeletePost(ctx contractapi.TransactionContextInterface,
 			}
 			parentPost.Replies = removeElement(parentPost.Replies, findIndex(parentPost.Replies, existingComment.ID))
 			parentPostJson, _ := json.Marshal(parentPost)
-			ctx.GetStub().PutState(existingComment.Parent, parentPostJson)
+			putState(ctx, commentObjectType, existingComment.Parent, parentPostJson)
 		}
 		existingComment.Hidden = true
 		commentJson, _ := json.Marshal(existingComment)
-		ctx.GetStub().PutState(postId, commentJson)
-		return nil
+		putState(ctx, commentObjectType, postId, commentJson)
+		return emitEvent(ctx, ContentDeletedEvent, ContentEventPayload{ItemId: postId, ItemType: commentObjectType, CommunityId: existingComment.Community, UserId: userId})
 	}
 }
 
-/*
-Allows users to appeal a hidden post or comment within a community.
-It takes postId or comment Id and user Id as parameters
-It adds the post or comment to the list of appealed items in the associated community
-*/
-func (s *SmartContract) AppealPost(ctx contractapi.TransactionContextInterface, postId string, userId string) error {
-	isAppealedVal, err := s.isAppealed(ctx, postId)
-	if err != nil {
-		return err
-	}
-	if isAppealedVal {
-		return nil
-	}
+func (s *SmartContract) isAppealed(ctx contractapi.TransactionContextInterface, postId string) (bool, error) {
 	var communityId string
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingPost == nil {
-			return fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		if existingPost.Hidden {
-			return nil
-		}
-		communityId = existingPost.Community
-
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingComment == nil {
-			return fmt.Errorf("Comment with ID %s doesn't exists", postId)
-		}
-		if existingComment.Hidden {
-			return nil
-		}
-		communityId = existingComment.Community
-	}
-	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	itemType, err := s.getItemType(ctx, postId)
 	if err != nil {
-		return err
-	}
-	if existingCommunity == nil {
-		return fmt.Errorf("Community with ID %s doesn't exists", communityId)
+		return false, err
 	}
-	// if !contains(existingCommunity.Users, userId) {
-	// 	return fmt.Errorf("User cannot appeal as you are not part of the community")
-	// }
-	existingCommunity.Appealed = append(existingCommunity.Appealed, postId)
-	communityJson, _ := json.Marshal(existingCommunity)
-	ctx.GetStub().PutState(communityId, communityJson)
-	return nil
-}
-
-func (s *SmartContract) isAppealed(ctx contractapi.TransactionContextInterface, postId string) (bool, error) {
-	var communityId string
-	if postId[0] == 'p' {
+	if itemType == postObjectType {
 		existingPost, err := s.GetPost(ctx, postId)
 		if err != nil {
 			return false, err
@@ -1954,100 +2048,24 @@ func (s *SmartContract) isAppealed(ctx contractapi.TransactionContextInterface,
 }
 
 /*
-Allows moderators to hide posts or comments that are appealed within a community.
-It verifies the moderator status of the user and increments the hide count for the post or comment.
-If the hide count reaches a threshold (half of the total moderators in the community), the associated content is marked as hidden
-If post is hidden then it is removed from the appeal list and post list of the community.
+Allows moderators to vote to hide posts or comments that have an open moderation case within a community.
+If the hide votes reach a majority of the community's moderators, the case is decided and the content is hidden.
+If post is hidden then it is removed from the post list of the community.
 If comments is hidden then it is also removed from its parent's list of replies.
+The moderator can cite the number of the community rule the content breaks, or 0 to cite none;
+hidden content records the rule cited by the most hide votes.
 */
-func (s *SmartContract) HidePostModerator(ctx contractapi.TransactionContextInterface, postId string, userId string) error {
-	var communityId string
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingPost == nil {
-			return fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		communityId = existingPost.Community
-		existingCommunity, err := s.GetCommunity(ctx, communityId)
-		if err != nil {
-			return err
-		}
-		if existingCommunity == nil {
-			return fmt.Errorf("Community with ID %s doesn't exists", communityId)
-		}
-		if !contains(existingCommunity.Moderators, userId) {
-			return fmt.Errorf("User cannot hide as you are not a moderator")
-		}
-		if contains(existingPost.HideVote, userId) {
-			return fmt.Errorf("User already voted")
-		}
-		existingPost.HideCount += 1
-		existingPost.HideVote = append(existingPost.HideVote, userId)
-		if existingPost.HideCount >= int(math.Ceil(float64(len(existingCommunity.Moderators))/2.0)) {
-			existingPost.Hidden = true
-			existingCommunity.Appealed = removeElement(existingCommunity.Appealed, findIndex(existingCommunity.Appealed, postId))
-			existingCommunity.Posts = removeElement(existingCommunity.Posts, findIndex(existingCommunity.Posts, postId))
-			communityJson, _ := json.Marshal(existingCommunity)
-			ctx.GetStub().PutState(communityId, communityJson)
-		}
-		postJson, _ := json.Marshal(existingPost)
-		ctx.GetStub().PutState(postId, postJson)
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingComment == nil {
-			return fmt.Errorf("Comment with ID %s doesn't exists", postId)
-		}
-		communityId = existingComment.Community
-		existingCommunity, err := s.GetCommunity(ctx, communityId)
-		if err != nil {
-			return err
-		}
-		if existingCommunity == nil {
-			return fmt.Errorf("Community with ID %s doesn't exists", communityId)
-		}
-		if !contains(existingCommunity.Moderators, userId) {
-			return fmt.Errorf("User cannot hide as you are not a moderator")
-		}
-		if contains(existingComment.HideVote, userId) {
-			return fmt.Errorf("User already voted")
-		}
-		existingComment.HideCount += 1
-		existingComment.HideVote = append(existingComment.HideVote, userId)
-		if existingComment.HideCount >= int(math.Ceil(float64(len(existingCommunity.Moderators))/2.0)) {
-			existingComment.Hidden = true
-			parentId := existingComment.Parent
-			if parentId[0] == 'p' {
-				existingParent, _ := s.GetPost(ctx, parentId)
-				existingParent.Comments = removeElement(existingParent.Comments, findIndex(existingParent.Comments, postId))
-				parentJson, _ := json.Marshal(existingParent)
-				ctx.GetStub().PutState(parentId, parentJson)
-			} else {
-				existingParent, _ := s.GetComment(ctx, parentId)
-				existingParent.Replies = removeElement(existingParent.Replies, findIndex(existingParent.Replies, postId))
-				parentJson, _ := json.Marshal(existingParent)
-				ctx.GetStub().PutState(parentId, parentJson)
-			}
-
-			existingCommunity.Appealed = removeElement(existingCommunity.Appealed, findIndex(existingCommunity.Appealed, postId))
-			communityJson, _ := json.Marshal(existingCommunity)
-			ctx.GetStub().PutState(communityId, communityJson)
-		}
-		commentJson, _ := json.Marshal(existingComment)
-		ctx.GetStub().PutState(postId, commentJson)
-	}
-	return nil
+func (s *SmartContract) HidePostModerator(ctx contractapi.TransactionContextInterface, postId string, userId string, rule int) error {
+	return s.castModerationVote(ctx, postId, userId, "hide", rule)
 }
 
 /*
 Helps in selecting moderators for a given community based on the reputation.
-The function  evaluates user activity by summing the scores of their posts.
-Users are ranked by their aggregated scores, and the top users, up to the required number of moderators, are chosen as new moderators for the community.
+The function scores the eligible members with the community's moderator scoring, see rankModeratorCandidates.
+Members are ranked by their scores, and the top members, up to the required number of moderators, are chosen as new moderators for the community.
+Moderators appointed with AddModerator stay alongside them while they remain eligible members.
+Anyone can run the selection once it is due, see nextModeratorSelection; the service does so on schedule.
+Communities that elect their moderators, or that have no eligible member, are left unchanged.
 */
 func (s *SmartContract) SelectModerator(ctx contractapi.TransactionContextInterface, communityId string) error {
 	existingCommunity, err := s.GetCommunity(ctx, communityId)
@@ -2057,184 +2075,65 @@ func (s *SmartContract) SelectModerator(ctx contractapi.TransactionContextInterf
 	if existingCommunity == nil {
 		return fmt.Errorf("Community with ID %s doesn't exists", communityId)
 	}
+	if moderatorSelection(existingCommunity) == ModeratorSelectionElection {
+		return nil // elected moderators stay until the next election closes
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	nextSelection := nextModeratorSelection(existingCommunity)
+	if currentTime.Before(nextSelection) {
+		return fmt.Errorf("Moderators of community %s can't be selected before %s", communityId, nextSelection.Format(time.RFC3339))
+	}
+	existingCommunity.ModeratorsSelected = currentTime
 	sizeCommunity := len(existingCommunity.Users)
 	noOfModeratorsRequired := int(math.Ceil(float64(sizeCommunity) * 0.1))
 	noOfModeratorsRequired = max(noOfModeratorsRequired, 1)
 	noOfModeratorsRequired = min(noOfModeratorsRequired, 100)
-	userMap := make(map[string]int)
-	for _, postId := range existingCommunity.Posts {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingPost == nil {
-			return fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		val, exists := userMap[existingPost.Author]
-		if exists {
-			userMap[existingPost.Author] = val + existingPost.Score
-		} else {
-			userMap[existingPost.Author] = existingPost.Score
-		}
+	scores, err := s.rankModeratorCandidates(ctx, existingCommunity)
+	if err != nil {
+		return err
 	}
-	keys := make([]string, 0, len(userMap))
-
-	for key := range userMap {
-		keys = append(keys, key)
+	if len(scores) == 0 {
+		// nobody is eligible, so the current moderators stay until the next selection
+		communityJson, _ := json.Marshal(existingCommunity)
+		putState(ctx, communityObjectType, communityId, communityJson)
+		return nil
 	}
-
-	sort.SliceStable(keys, func(i, j int) bool {
-		return userMap[keys[i]] > userMap[keys[j]]
-	})
-
 	var newModerators []string
-	for _, k := range keys {
-		newModerators = append(newModerators, k)
+	for _, score := range scores {
+		newModerators = append(newModerators, score.UserId)
 		if len(newModerators) == noOfModeratorsRequired {
 			break
 		}
 	}
-	existingCommunity.Moderators = newModerators
-	communityJson, _ := json.Marshal(existingCommunity)
-	ctx.GetStub().PutState(communityId, communityJson)
-	return nil
-}
-
-/*
-Allow users to retract their appeal on a post or comment.
-It checks the user's membership in the community.
-The function removes the user's appeal from the list of appeals for the specific post or comment.
-*/
-func (s *SmartContract) UnAppealPost(ctx contractapi.TransactionContextInterface, postId string, userId string) error {
-	var communityId string
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingPost == nil {
-			return fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-
-		communityId = existingPost.Community
-
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingComment == nil {
-			return fmt.Errorf("Comment with ID %s doesn't exists", postId)
+	newModerators, appointed := s.keepAppointedModerators(ctx, existingCommunity, newModerators)
+	for _, moderator := range newModerators {
+		if !contains(existingCommunity.Moderators, moderator) {
+			err = s.notify(ctx, moderator, NotificationModerator, "", "", "", communityId, 0)
+			if err != nil {
+				return err
+			}
 		}
-		communityId = existingComment.Community
 	}
-	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	err = logModeratorChanges(ctx, communityId, "", existingCommunity.Moderators, newModerators)
 	if err != nil {
 		return err
 	}
-	if existingCommunity == nil {
-		return fmt.Errorf("Community with ID %s doesn't exists", communityId)
-	}
-	if !contains(existingCommunity.Users, userId) {
-		return fmt.Errorf("User cannot appeal as you are not part of the community")
-	}
-	if !contains(existingCommunity.Appealed, postId) {
-		return fmt.Errorf("User cannot unappeal the post")
-	}
-	existingCommunity.Appealed = removeElement(existingCommunity.Appealed, findIndex(existingCommunity.Appealed, postId))
+	existingCommunity.Moderators = newModerators
+	existingCommunity.Appointed = appointed
 	communityJson, _ := json.Marshal(existingCommunity)
-	ctx.GetStub().PutState(communityId, communityJson)
-	return nil
+	putState(ctx, communityObjectType, communityId, communityJson)
+	return emitEvent(ctx, ModeratorsChangedEvent, ModeratorsEventPayload{CommunityId: communityId, Moderators: newModerators})
 }
 
 /*
-Allows moderators to uhide/Show posts or comments that are appealed within a community.
-It verifies the moderator status of the user and increments the show count for the post or comment.
-If the show count reaches a threshold (half of the total moderators in the community), the associated content is removed from the appealed list of that community.
+Allows moderators to vote to keep posts or comments that have an open moderation case within a community.
+If the show votes reach a majority of the community's moderators, the case is decided and the content is upheld.
 */
 func (s *SmartContract) ShowPostModerator(ctx contractapi.TransactionContextInterface, postId string, userId string) error {
-	var communityId string
-	if postId[0] == 'p' {
-		existingPost, err := s.GetPost(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingPost == nil {
-			return fmt.Errorf("Post with ID %s doesn't exists", postId)
-		}
-		communityId = existingPost.Community
-		existingCommunity, err := s.GetCommunity(ctx, communityId)
-		if err != nil {
-			return err
-		}
-		if existingCommunity == nil {
-			return fmt.Errorf("Community with ID %s doesn't exists", communityId)
-		}
-		if !contains(existingCommunity.Moderators, userId) {
-			return fmt.Errorf("User cannot hide as you are not a moderator")
-		}
-		if contains(existingPost.ShowVote, userId) {
-			return fmt.Errorf("User already voted")
-		}
-		existingPost.ShowCount += 1
-		existingPost.ShowVote = append(existingPost.ShowVote, userId)
-		if existingPost.ShowCount >= int(math.Ceil(float64(len(existingCommunity.Moderators))/2.0)) {
-			//existingPost.Hidden = true
-			existingPost.ShowCount = -100
-			existingCommunity.Appealed = removeElement(existingCommunity.Appealed, findIndex(existingCommunity.Appealed, postId))
-			//existingCommunity.Posts = removeElement(existingCommunity.Posts, findIndex(existingCommunity.Posts, postId))
-			communityJson, _ := json.Marshal(existingCommunity)
-			ctx.GetStub().PutState(communityId, communityJson)
-		}
-		postJson, _ := json.Marshal(existingPost)
-		ctx.GetStub().PutState(postId, postJson)
-	} else {
-		existingComment, err := s.GetComment(ctx, postId)
-		if err != nil {
-			return err
-		}
-		if existingComment == nil {
-			return fmt.Errorf("Comment with ID %s doesn't exists", postId)
-		}
-		communityId = existingComment.Community
-		existingCommunity, err := s.GetCommunity(ctx, communityId)
-		if err != nil {
-			return err
-		}
-		if existingCommunity == nil {
-			return fmt.Errorf("Community with ID %s doesn't exists", communityId)
-		}
-		if !contains(existingCommunity.Moderators, userId) {
-			return fmt.Errorf("User cannot hide as you are not a moderator")
-		}
-		if contains(existingComment.ShowVote, userId) {
-			return fmt.Errorf("User already voted")
-		}
-		existingComment.ShowCount += 1
-		existingComment.ShowVote = append(existingComment.ShowVote, userId)
-		if existingComment.ShowCount >= int(math.Ceil(float64(len(existingCommunity.Moderators))/2.0)) {
-			//existingComment.Hidden = true
-			// parentId := existingComment.Parent
-			// if parentId[0] == 'p' {
-			// 	existingParent, _ := s.GetPost(ctx, parentId)
-			// 	existingParent.Comments = removeElement(existingParent.Comments, findIndex(existingParent.Comments, postId))
-			// 	parentJson, _ := json.Marshal(existingParent)
-			// 	ctx.GetStub().PutState(parentId, parentJson)
-			// } else {
-			// 	existingParent, _ := s.GetComment(ctx, parentId)
-			// 	existingParent.Replies = removeElement(existingParent.Replies, findIndex(existingParent.Replies, postId))
-			// 	parentJson, _ := json.Marshal(existingParent)
-			// 	ctx.GetStub().PutState(parentId, parentJson)
-			// }
-			existingComment.ShowCount = -100
-			existingCommunity.Appealed = removeElement(existingCommunity.Appealed, findIndex(existingCommunity.Appealed, postId))
-			communityJson, _ := json.Marshal(existingCommunity)
-			ctx.GetStub().PutState(communityId, communityJson)
-		}
-		commentJson, _ := json.Marshal(existingComment)
-		ctx.GetStub().PutState(postId, commentJson)
-	}
-	return nil
+	return s.castModerationVote(ctx, postId, userId, "show", 0)
 }
 
 //unappeal undo done
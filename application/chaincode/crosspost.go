@@ -0,0 +1,183 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object type of the keys that record which communities a post has been cross-posted to
+const crossPostObjectType = "crossPost"
+
+/*
+Returns the Id of the post that votes, comments and poll votes on a post are attached to:
+the original post for a cross-post, the post itself otherwise. Ids of comments are returned unchanged.
+*/
+func (s *SmartContract) resolvePostId(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	existingPost, err := s.GetPost(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if existingPost == nil || existingPost.CrossPostOf == "" {
+		return id, nil
+	}
+	return existingPost.CrossPostOf, nil
+}
+
+/*
+Shares a post into another community. It takes the original post's Id, the target community's Id and the user's Id.
+The user must be a member of both the original post's community and the target community, and a post can be cross-posted
+to a community only once; cross-posting a cross-post shares its original. The original must meet the target community's posting requirements.
+The cross-post is a post of the target community that shows the original's content: votes, comments and poll votes
+go to the original, while hiding, appeals and moderation apply to each community's post separately.
+Hiding or deleting the original removes it from every community.
+*/
+func (s *SmartContract) CrossPost(ctx contractapi.TransactionContextInterface, postId string, communityId string, userId string) (*Post, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	originalId, err := s.resolvePostId(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	originalPost, err := s.GetPost(ctx, originalId)
+	if err != nil {
+		return nil, err
+	}
+	if originalPost == nil {
+		return nil, fmt.Errorf("Post with ID %s doesn't exists", postId)
+	}
+	if originalPost.Hidden {
+		return nil, fmt.Errorf("Post with ID %s is hidden and cannot be cross-posted", postId)
+	}
+	if originalPost.Community == communityId {
+		return nil, fmt.Errorf("Post with ID %s already belongs to community %s", postId, communityId)
+	}
+	originalCommunity, err := s.GetCommunity(ctx, originalPost.Community)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(originalCommunity.Users, userId) {
+		return nil, fmt.Errorf("User cannot cross-post as you are not a member of community %s", originalPost.Community)
+	}
+	if communityVisibility(originalCommunity) == CommunityPrivate {
+		return nil, fmt.Errorf("Posts of private community %s cannot be cross-posted", originalPost.Community)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(existingCommunity.Users, userId) {
+		return nil, fmt.Errorf("User cannot cross-post as you are not a member of community %s", communityId)
+	}
+	err = s.checkNotBanned(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	crossPostKey, err := ctx.GetStub().CreateCompositeKey(crossPostObjectType, []string{originalId, communityId})
+	if err != nil {
+		return nil, err
+	}
+	existingCrossPost, err := ctx.GetStub().GetState(crossPostKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cross-post from ledger: %w", err)
+	}
+	if existingCrossPost != nil {
+		return nil, fmt.Errorf("Post with ID %s has already been cross-posted to community %s", postId, communityId)
+	}
+	existingUser, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", userId)
+	}
+	err = s.checkPostRequirements(ctx, existingCommunity, existingUser, postType(originalPost), originalPost.Title, originalPost.Content)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := newEntityId(ctx, "p")
+	post := Post{
+		ID:          id,
+		Author:      userId,
+		CreatedAt:   currentTime,
+		Comments:    make([]string, 0),
+		Community:   communityId,
+		HideVote:    make([]string, 0),
+		ShowVote:    make([]string, 0),
+		Type:        postType(originalPost),
+		CrossPostOf: originalId,
+	}
+	originalPost.CrossPosts = append(originalPost.CrossPosts, id)
+	existingCommunity.Posts = append(existingCommunity.Posts, id)
+	existingUser.Posts = append(existingUser.Posts, id)
+	originalJson, _ := json.Marshal(originalPost)
+	putState(ctx, postObjectType, originalId, originalJson)
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	userJson, _ := json.Marshal(existingUser)
+	putState(ctx, userObjectType, userId, userJson)
+	postJson, _ := json.Marshal(post)
+	putState(ctx, postObjectType, id, postJson)
+	err = ctx.GetStub().PutState(crossPostKey, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, communityPostIndex, communityId, currentTime, id)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, authorPostIndex, userId, currentTime, id)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, PostCrossPostedEvent, post)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+/*
+Wraps an accept function for a feed merged from several communities so that each post appears once:
+a cross-post is skipped when its original, or an earlier visible cross-post of it, is in one of the feed's communities.
+The decision depends only on the post, so it holds across pages.
+*/
+func (s *SmartContract) dedupeCrossPosts(ctx contractapi.TransactionContextInterface, communityIds []string, posts map[string]*Post, accept func(string) (bool, error)) func(string) (bool, error) {
+	return func(postId string) (bool, error) {
+		accepted, err := accept(postId)
+		if err != nil || !accepted {
+			return false, err
+		}
+		post := posts[postId]
+		if post.CrossPostOf == "" {
+			return true, nil
+		}
+		originalPost, err := s.GetPost(ctx, post.CrossPostOf)
+		if err != nil {
+			return false, err
+		}
+		if contains(communityIds, originalPost.Community) {
+			return false, nil
+		}
+		for _, crossPostId := range originalPost.CrossPosts {
+			if crossPostId == postId {
+				break
+			}
+			crossPost, err := s.GetPost(ctx, crossPostId)
+			if err != nil {
+				return false, err
+			}
+			if crossPost != nil && !crossPost.Hidden && contains(communityIds, crossPost.Community) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
@@ -0,0 +1,651 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// How a community chooses its moderators. Reputation selection is the periodic SelectModerator ranking;
+// election communities keep their moderators until an election closes.
+const (
+	ModeratorSelectionReputation = "reputation"
+	ModeratorSelectionElection   = "election"
+)
+
+// Ballot types of an election
+const (
+	ElectionRanked   = "ranked"   //voters rank candidates, seats are filled by instant-runoff one at a time
+	ElectionApproval = "approval" //voters approve any number of candidates, the most approved win
+)
+
+// Phases an election moves through, derived from its deadlines
+const (
+	ElectionNominating = "nominating"
+	ElectionVoting     = "voting"
+	ElectionEnded      = "ended" //voting is over and the election is waiting to be closed
+	ElectionClosed     = "closed"
+)
+
+// Elections are stored as entities and in their community's time-ordered list.
+// A ballot is stored under (electionBallot, election, voter) and can be replaced until voting ends.
+const (
+	electionObjectType = "election"
+	electionIndex      = "electionIndex"
+	ballotObjectType   = "electionBallot"
+)
+
+const (
+	MaxElectionSeats      = 25
+	MaxElectionCandidates = 50
+	ElectionsPerPage      = 20
+)
+
+type Candidate struct {
+	UserId      string `json:"userId"`
+	NominatedBy string `json:"nominatedBy"`
+}
+
+/*
+Votes a candidate received: approvals in an approval election, first preferences in a ranked one.
+*/
+type CandidateResult struct {
+	UserId string `json:"userId"`
+	Votes  int    `json:"votes"`
+}
+
+type Election struct {
+	ID                 string            `json:"id"`
+	CommunityId        string            `json:"communityId"`
+	Method             string            `json:"method"`
+	Seats              int               `json:"seats"`
+	CreatedBy          string            `json:"createdBy"`
+	CreatedAt          time.Time         `json:"createdAt"`
+	NominationsCloseAt time.Time         `json:"nominationsCloseAt"`
+	VotingClosesAt     time.Time         `json:"votingClosesAt"`
+	Candidates         []Candidate       `json:"candidates"`
+	Phase              string            `json:"phase"`
+	Ballots            int               `json:"ballots"` //ballots counted, set when the election closes
+	Results            []CandidateResult `json:"results"`
+	Winners            []string          `json:"winners"`
+}
+
+type Ballot struct {
+	ElectionId string    `json:"electionId"`
+	Voter      string    `json:"voter"`
+	Choices    []string  `json:"choices"` //candidate user Ids, in order of preference for a ranked election
+	CastAt     time.Time `json:"castAt"`
+}
+
+type ElectionPage struct {
+	Elections  []*Election `json:"elections"`
+	NextCursor string      `json:"nextCursor"` //empty on the last page
+}
+
+type ElectionEventPayload struct {
+	ElectionId  string   `json:"electionId"`
+	CommunityId string   `json:"communityId"`
+	UserId      string   `json:"userId,omitempty"`
+	Winners     []string `json:"winners,omitempty"`
+}
+
+type ModeratorSelectionEventPayload struct {
+	CommunityId string `json:"communityId"`
+	UserId      string `json:"userId"`
+	Selection   string `json:"selection"`
+}
+
+/*
+Communities created before elections existed have no selection mode and use reputation.
+*/
+func moderatorSelection(community *Community) string {
+	if community.ModeratorSelection == "" {
+		return ModeratorSelectionReputation
+	}
+	return community.ModeratorSelection
+}
+
+func electionPhase(election *Election, now time.Time) string {
+	if election.Phase == ElectionClosed {
+		return ElectionClosed
+	}
+	if now.Before(election.NominationsCloseAt) {
+		return ElectionNominating
+	}
+	if now.Before(election.VotingClosesAt) {
+		return ElectionVoting
+	}
+	return ElectionEnded
+}
+
+func (s *SmartContract) getElection(ctx contractapi.TransactionContextInterface, electionId string) (*Election, error) {
+	electionJson, err := getState(ctx, electionObjectType, electionId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read election from ledger: %w", err)
+	}
+	if electionJson == nil {
+		return nil, fmt.Errorf("Election with ID %s doesn't exists", electionId)
+	}
+	var election Election
+	err = json.Unmarshal(electionJson, &election)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	election.Phase = electionPhase(&election, currentTime)
+	return &election, nil
+}
+
+func saveElection(ctx contractapi.TransactionContextInterface, election *Election) error {
+	electionJson, _ := json.Marshal(election)
+	return putState(ctx, electionObjectType, election.ID, electionJson)
+}
+
+func candidateIds(election *Election) []string {
+	ids := make([]string, 0, len(election.Candidates))
+	for _, candidate := range election.Candidates {
+		ids = append(ids, candidate.UserId)
+	}
+	return ids
+}
+
+/*
+Checks that the user is a member of the community who isn't banned from it, as voters and candidates must be.
+*/
+func (s *SmartContract) checkEligibleMember(ctx contractapi.TransactionContextInterface, community *Community, userId string) error {
+	if !contains(community.Users, userId) {
+		return fmt.Errorf("User with ID %s is not a member of community %s", userId, community.ID)
+	}
+	return s.checkNotBanned(ctx, community.ID, userId)
+}
+
+/*
+Chooses how a community selects its moderators: "reputation" or "election". Only moderators of the community can change it,
+and not while an election is running.
+*/
+func (s *SmartContract) SetModeratorSelection(ctx contractapi.TransactionContextInterface, communityId string, selection string, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	if selection != ModeratorSelectionReputation && selection != ModeratorSelectionElection {
+		return fmt.Errorf("Invalid moderator selection %s", selection)
+	}
+	if existingCommunity.Election != "" {
+		return fmt.Errorf("Community %s has an election running, close it first", communityId)
+	}
+	existingCommunity.ModeratorSelection = selection
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	return emitEvent(ctx, ModeratorSelectionChangedEvent, ModeratorSelectionEventPayload{CommunityId: communityId, UserId: userId, Selection: selection})
+}
+
+/*
+Starts a moderator election in a community that elects its moderators. Only moderators of the community can start one,
+and a community runs one election at a time. It takes the ballot type ("ranked" or "approval"), the number of seats
+and the times, in RFC 3339 format, at which nominations and voting close.
+*/
+func (s *SmartContract) StartElection(ctx contractapi.TransactionContextInterface, communityId string, method string, seats int, nominationsCloseAt string, votingClosesAt string, userId string) (*Election, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if moderatorSelection(existingCommunity) != ModeratorSelectionElection {
+		return nil, fmt.Errorf("Community %s selects its moderators by reputation", communityId)
+	}
+	if existingCommunity.Election != "" {
+		return nil, fmt.Errorf("Community %s already has an election running", communityId)
+	}
+	if method != ElectionRanked && method != ElectionApproval {
+		return nil, fmt.Errorf("Invalid election method %s", method)
+	}
+	if seats < 1 || seats > MaxElectionSeats {
+		return nil, fmt.Errorf("An election must have between 1 and %d seats", MaxElectionSeats)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nominationsClose, err := time.Parse(time.RFC3339, nominationsCloseAt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid nominations close time %s", nominationsCloseAt)
+	}
+	votingClose, err := time.Parse(time.RFC3339, votingClosesAt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid voting close time %s", votingClosesAt)
+	}
+	if !nominationsClose.After(currentTime) {
+		return nil, fmt.Errorf("Nominations close time %s has already passed", nominationsCloseAt)
+	}
+	if !votingClose.After(nominationsClose) {
+		return nil, fmt.Errorf("Voting must close after nominations close")
+	}
+	election := Election{
+		ID:                 newEntityId(ctx, "el"),
+		CommunityId:        communityId,
+		Method:             method,
+		Seats:              seats,
+		CreatedBy:          userId,
+		CreatedAt:          currentTime,
+		NominationsCloseAt: nominationsClose.UTC(),
+		VotingClosesAt:     votingClose.UTC(),
+		Candidates:         make([]Candidate, 0),
+		Results:            make([]CandidateResult, 0),
+		Winners:            make([]string, 0),
+	}
+	err = saveElection(ctx, &election)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, electionIndex, communityId, currentTime, election.ID)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity.Election = election.ID
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	err = emitEvent(ctx, ElectionStartedEvent, ElectionEventPayload{ElectionId: election.ID, CommunityId: communityId, UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	election.Phase = electionPhase(&election, currentTime)
+	return &election, nil
+}
+
+/*
+Nominates a member of the community as a candidate while nominations are open. Members can nominate themselves;
+both the nominating member and the candidate must be members who aren't banned.
+*/
+func (s *SmartContract) NominateCandidate(ctx contractapi.TransactionContextInterface, electionId string, candidateId string, userId string) (*Election, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	election, err := s.getElection(ctx, electionId)
+	if err != nil {
+		return nil, err
+	}
+	if election.Phase != ElectionNominating {
+		return nil, fmt.Errorf("Nominations for election %s are closed", electionId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, election.CommunityId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkEligibleMember(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkEligibleMember(ctx, existingCommunity, candidateId)
+	if err != nil {
+		return nil, err
+	}
+	if contains(candidateIds(election), candidateId) {
+		return nil, fmt.Errorf("User with ID %s is already a candidate in election %s", candidateId, electionId)
+	}
+	if len(election.Candidates) >= MaxElectionCandidates {
+		return nil, fmt.Errorf("An election can't have more than %d candidates", MaxElectionCandidates)
+	}
+	election.Candidates = append(election.Candidates, Candidate{UserId: candidateId, NominatedBy: userId})
+	err = saveElection(ctx, election)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, CandidateNominatedEvent, ElectionEventPayload{ElectionId: electionId, CommunityId: election.CommunityId, UserId: candidateId})
+	if err != nil {
+		return nil, err
+	}
+	return election, nil
+}
+
+/*
+Casts or replaces the user's ballot while voting is open. The choices are a JSON array of candidate user Ids:
+in order of preference for a ranked election, the approved candidates for an approval election.
+*/
+func (s *SmartContract) CastBallot(ctx contractapi.TransactionContextInterface, electionId string, choicesJson string, userId string) (*Ballot, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	election, err := s.getElection(ctx, electionId)
+	if err != nil {
+		return nil, err
+	}
+	if election.Phase != ElectionVoting {
+		return nil, fmt.Errorf("Election %s is not open for voting", electionId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, election.CommunityId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkEligibleMember(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	var choices []string
+	err = json.Unmarshal([]byte(choicesJson), &choices)
+	if err != nil {
+		return nil, fmt.Errorf("Choices must be a JSON array of candidate Ids: %w", err)
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("A ballot must choose at least one candidate")
+	}
+	candidates := candidateIds(election)
+	for i, choice := range choices {
+		if !contains(candidates, choice) {
+			return nil, fmt.Errorf("User with ID %s is not a candidate in election %s", choice, electionId)
+		}
+		if contains(choices[:i], choice) {
+			return nil, fmt.Errorf("Candidate %s is chosen more than once", choice)
+		}
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ballot := Ballot{
+		ElectionId: electionId,
+		Voter:      userId,
+		Choices:    choices,
+		CastAt:     currentTime,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(ballotObjectType, []string{electionId, userId})
+	if err != nil {
+		return nil, err
+	}
+	ballotJson, _ := json.Marshal(ballot)
+	err = ctx.GetStub().PutState(key, ballotJson)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, BallotCastEvent, ElectionEventPayload{ElectionId: electionId, CommunityId: election.CommunityId, UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	return &ballot, nil
+}
+
+/*
+Tallies an election once voting has ended and makes the winners the community's moderators. Anyone can close an
+ended election. Only ballots of voters who are still members count, and candidates who left or were banned are
+skipped. Moderators appointed through AddModerator stay alongside the winners. If nobody wins, the current moderators stay.
+*/
+func (s *SmartContract) CloseElection(ctx contractapi.TransactionContextInterface, electionId string) (*Election, error) {
+	election, err := s.getElection(ctx, electionId)
+	if err != nil {
+		return nil, err
+	}
+	if election.Phase != ElectionEnded {
+		return nil, fmt.Errorf("Election %s can't be closed while it is %s", electionId, election.Phase)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, election.CommunityId)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]string, 0, len(election.Candidates))
+	for _, candidateId := range candidateIds(election) {
+		if s.checkEligibleMember(ctx, existingCommunity, candidateId) == nil {
+			candidates = append(candidates, candidateId)
+		}
+	}
+	ballots, err := s.countableBallots(ctx, existingCommunity, electionId, candidates)
+	if err != nil {
+		return nil, err
+	}
+	if election.Method == ElectionRanked {
+		election.Winners, election.Results = rankedTally(ballots, candidates, election.Seats)
+	} else {
+		election.Winners, election.Results = approvalTally(ballots, candidates, election.Seats)
+	}
+	election.Ballots = len(ballots)
+	election.Phase = ElectionClosed
+	err = saveElection(ctx, election)
+	if err != nil {
+		return nil, err
+	}
+	if len(election.Winners) > 0 {
+		newModerators, appointed := s.keepAppointedModerators(ctx, existingCommunity, append([]string(nil), election.Winners...))
+		err = logModeratorChanges(ctx, existingCommunity.ID, "", existingCommunity.Moderators, newModerators)
+		if err != nil {
+			return nil, err
+		}
+		for _, winner := range election.Winners {
+			if !contains(existingCommunity.Moderators, winner) {
+				err = s.notify(ctx, winner, NotificationModerator, "", "", "", existingCommunity.ID, 0)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		existingCommunity.Moderators = newModerators
+		existingCommunity.Appointed = appointed
+	}
+	existingCommunity.Election = ""
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, existingCommunity.ID, communityJson)
+	err = emitEvent(ctx, ElectionClosedEvent, ElectionEventPayload{ElectionId: electionId, CommunityId: existingCommunity.ID, Winners: election.Winners})
+	if err != nil {
+		return nil, err
+	}
+	return election, nil
+}
+
+/*
+Reads the ballots of an election that count: those of voters who are still members and aren't banned,
+with choices of candidates who are no longer eligible removed. Ballots left with no choice are dropped.
+*/
+func (s *SmartContract) countableBallots(ctx contractapi.TransactionContextInterface, community *Community, electionId string, candidates []string) ([][]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ballotObjectType, []string{electionId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ballots := make([][]string, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var ballot Ballot
+		err = json.Unmarshal(queryResponse.Value, &ballot)
+		if err != nil {
+			return nil, err
+		}
+		if s.checkEligibleMember(ctx, community, ballot.Voter) != nil {
+			continue
+		}
+		choices := make([]string, 0, len(ballot.Choices))
+		for _, choice := range ballot.Choices {
+			if contains(candidates, choice) {
+				choices = append(choices, choice)
+			}
+		}
+		if len(choices) > 0 {
+			ballots = append(ballots, choices)
+		}
+	}
+	return ballots, nil
+}
+
+/*
+Orders candidates by votes, most first, and by user Id on a tie, so every peer computes the same order.
+*/
+func sortedResults(counts map[string]int, candidates []string) []CandidateResult {
+	results := make([]CandidateResult, 0, len(candidates))
+	for _, candidate := range candidates {
+		results = append(results, CandidateResult{UserId: candidate, Votes: counts[candidate]})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Votes != results[j].Votes {
+			return results[i].Votes > results[j].Votes
+		}
+		return results[i].UserId < results[j].UserId
+	})
+	return results
+}
+
+/*
+The candidates with the most approvals win, as long as someone approved them.
+*/
+func approvalTally(ballots [][]string, candidates []string, seats int) ([]string, []CandidateResult) {
+	counts := make(map[string]int)
+	for _, ballot := range ballots {
+		for _, choice := range ballot {
+			counts[choice]++
+		}
+	}
+	results := sortedResults(counts, candidates)
+	winners := make([]string, 0, seats)
+	for _, result := range results {
+		if len(winners) == seats || result.Votes == 0 {
+			break
+		}
+		winners = append(winners, result.UserId)
+	}
+	return winners, results
+}
+
+/*
+Fills the seats one at a time by instant-runoff. For each seat, every ballot counts for its highest ranked
+candidate still running; a candidate with a majority wins the seat, otherwise the candidate with the fewest votes
+is eliminated and the count is repeated. Of candidates tied for fewest votes, the one with the highest user Id
+is eliminated. Winners don't run for later seats. Results hold the first preferences.
+*/
+func rankedTally(ballots [][]string, candidates []string, seats int) ([]string, []CandidateResult) {
+	firstPreferences := make(map[string]int)
+	for _, ballot := range ballots {
+		firstPreferences[ballot[0]]++
+	}
+	winners := make([]string, 0, seats)
+	for len(winners) < seats {
+		running := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			if !contains(winners, candidate) {
+				running = append(running, candidate)
+			}
+		}
+		winner := instantRunoff(ballots, running)
+		if winner == "" {
+			break
+		}
+		winners = append(winners, winner)
+	}
+	return winners, sortedResults(firstPreferences, candidates)
+}
+
+/*
+Returns the instant-runoff winner among the running candidates, or an empty string if no ballot ranks any of them.
+*/
+func instantRunoff(ballots [][]string, running []string) string {
+	for len(running) > 0 {
+		counts := make(map[string]int)
+		total := 0
+		for _, ballot := range ballots {
+			for _, choice := range ballot {
+				if contains(running, choice) {
+					counts[choice]++
+					total++
+					break
+				}
+			}
+		}
+		if total == 0 {
+			return ""
+		}
+		results := sortedResults(counts, running)
+		if results[0].Votes*2 > total || len(results) == 1 {
+			return results[0].UserId
+		}
+		eliminated := results[len(results)-1].UserId
+		running = removeElement(running, findIndex(running, eliminated))
+	}
+	return ""
+}
+
+/*
+Returns an election with its current phase. Anyone who can read the community can read its elections.
+*/
+func (s *SmartContract) GetElection(ctx contractapi.TransactionContextInterface, electionId string, userId string) (*Election, error) {
+	election, err := s.getElection(ctx, electionId)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity, err := s.GetCommunity(ctx, election.CommunityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	return election, nil
+}
+
+/*
+Returns a page of a community's elections, newest first.
+*/
+func (s *SmartContract) GetCommunityElections(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string) (*ElectionPage, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	elections := make(map[string]*Election)
+	entries, err := scanIndexes(ctx, electionIndex, []string{communityId}, cursor, ElectionsPerPage+1, func(electionId string) (bool, error) {
+		election, err := s.getElection(ctx, electionId)
+		if err != nil {
+			return false, err
+		}
+		elections[electionId] = election
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, ElectionsPerPage)
+	page := ElectionPage{
+		Elections:  make([]*Election, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		page.Elections = append(page.Elections, elections[entry.itemId])
+	}
+	return &page, nil
+}
+
+/*
+Returns the user's own ballot in an election, or nil if the user hasn't voted. Only the user can read it.
+*/
+func (s *SmartContract) GetBallot(ctx contractapi.TransactionContextInterface, electionId string, userId string) (*Ballot, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(ballotObjectType, []string{electionId, userId})
+	if err != nil {
+		return nil, err
+	}
+	ballotJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ballot from ledger: %w", err)
+	}
+	if ballotJson == nil {
+		return nil, nil
+	}
+	var ballot Ballot
+	err = json.Unmarshal(ballotJson, &ballot)
+	if err != nil {
+		return nil, err
+	}
+	return &ballot, nil
+}
@@ -0,0 +1,94 @@
+package chaincode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstantRunoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		ballots [][]string
+		running []string
+		want    string
+	}{
+		{"no ballots", nil, []string{"a", "b"}, ""},
+		{"no candidates running", [][]string{{"a"}}, nil, ""},
+		{"no ballot ranks a running candidate", [][]string{{"x"}, {"y", "z"}}, []string{"a", "b"}, ""},
+		{"first round majority", [][]string{{"a"}, {"a"}, {"b"}}, []string{"a", "b"}, "a"},
+		{"single candidate", [][]string{{"a"}, {"x"}}, []string{"a"}, "a"},
+		{"eliminated candidate's votes transfer", [][]string{{"a"}, {"a"}, {"b"}, {"b"}, {"c", "b"}}, []string{"a", "b", "c"}, "b"},
+		{"later preferences skip candidates not running", [][]string{{"x", "b"}, {"a"}, {"x", "b"}}, []string{"a", "b"}, "b"},
+		{"two-way tie eliminates the highest user Id", [][]string{{"a"}, {"b"}}, []string{"a", "b"}, "a"},
+		{"three-way tie eliminates the highest user Ids", [][]string{{"c"}, {"b"}, {"a"}}, []string{"c", "b", "a"}, "a"},
+		{"tie for fewest votes", [][]string{{"a"}, {"a"}, {"b"}, {"c", "b"}, {"d", "c"}}, []string{"a", "b", "c", "d"}, "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			running := append([]string(nil), test.running...)
+			if got := instantRunoff(test.ballots, running); got != test.want {
+				t.Errorf("instantRunoff() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRankedTally(t *testing.T) {
+	tests := []struct {
+		name        string
+		ballots     [][]string
+		candidates  []string
+		seats       int
+		wantWinners []string
+		wantResults []CandidateResult
+	}{
+		{
+			name:        "no ballots",
+			candidates:  []string{"b", "a"},
+			seats:       1,
+			wantWinners: []string{},
+			wantResults: []CandidateResult{{"a", 0}, {"b", 0}},
+		},
+		{
+			name:        "no candidates",
+			seats:       1,
+			wantWinners: []string{},
+			wantResults: []CandidateResult{},
+		},
+		{
+			name:        "winners don't run for later seats",
+			ballots:     [][]string{{"a", "b"}, {"a", "b"}, {"b"}, {"c"}},
+			candidates:  []string{"a", "b", "c"},
+			seats:       2,
+			wantWinners: []string{"a", "b"},
+			wantResults: []CandidateResult{{"a", 2}, {"b", 1}, {"c", 1}},
+		},
+		{
+			name:        "seats left empty once no ballot ranks a running candidate",
+			ballots:     [][]string{{"a"}},
+			candidates:  []string{"a", "b", "c"},
+			seats:       3,
+			wantWinners: []string{"a"},
+			wantResults: []CandidateResult{{"a", 1}, {"b", 0}, {"c", 0}},
+		},
+		{
+			name:        "tied first preferences",
+			ballots:     [][]string{{"b", "a"}, {"a", "b"}},
+			candidates:  []string{"a", "b"},
+			seats:       1,
+			wantWinners: []string{"a"},
+			wantResults: []CandidateResult{{"a", 1}, {"b", 1}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			winners, results := rankedTally(test.ballots, test.candidates, test.seats)
+			if !reflect.DeepEqual(winners, test.wantWinners) {
+				t.Errorf("winners = %v, want %v", winners, test.wantWinners)
+			}
+			if !reflect.DeepEqual(results, test.wantResults) {
+				t.Errorf("results = %v, want %v", results, test.wantResults)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Version of the event envelope and payload layouts below.
+// Bump it whenever a payload changes in a way consumers have to know about.
+const EventSchemaVersion = 1
+
+// Event types emitted by the mutating transactions. Fabric keeps a single event per transaction,
+// so each transaction emits the one event that describes its outcome.
+const (
+	UserCreatedEvent                = "UserCreated"
+	CommunityCreatedEvent           = "CommunityCreated"
+	CommunityJoinedEvent            = "CommunityJoined"
+	CommunityLeftEvent              = "CommunityLeft"
+	PostCreatedEvent                = "PostCreated"
+	PostCrossPostedEvent            = "PostCrossPosted"
+	CommentCreatedEvent             = "CommentCreated"
+	ContentEditedEvent              = "ContentEdited"
+	VoteCastEvent                   = "VoteCast"
+	ContentDeletedEvent             = "ContentDeleted"
+	ContentAppealedEvent            = "ContentAppealed"
+	AppealFiledEvent                = "AppealFiled"
+	AppealThresholdChangedEvent     = "AppealThresholdChanged"
+	AppealWithdrawnEvent            = "AppealWithdrawn"
+	ModerationVoteEvent             = "ModerationVoteCast"
+	ContentHiddenEvent              = "ContentHidden"
+	ContentShownEvent               = "ContentShown"
+	CaseExpiredEvent                = "CaseExpired"
+	CasePolicyChangedEvent          = "CasePolicyChanged"
+	ModeratorsChangedEvent          = "ModeratorsChanged"
+	FlairsChangedEvent              = "FlairsChanged"
+	PollVoteCastEvent               = "PollVoteCast"
+	SavedItemsChangedEvent          = "SavedItemsChanged"
+	UserFollowedEvent               = "UserFollowed"
+	UserUnfollowedEvent             = "UserUnfollowed"
+	MessageSentEvent                = "MessageSent"
+	NotificationsChangedEvent       = "NotificationsChanged"
+	CommunityRulesChangedEvent      = "CommunityRulesChanged"
+	CommunityVisibilityChangedEvent = "CommunityVisibilityChanged"
+	JoinRequestedEvent              = "JoinRequested"
+	JoinRequestRejectedEvent        = "JoinRequestRejected"
+	UserBannedEvent                 = "UserBanned"
+	UserUnbannedEvent               = "UserUnbanned"
+	ModeratorSelectionChangedEvent  = "ModeratorSelectionChanged"
+	ElectionStartedEvent            = "ElectionStarted"
+	CandidateNominatedEvent         = "CandidateNominated"
+	BallotCastEvent                 = "BallotCast"
+	ElectionClosedEvent             = "ElectionClosed"
+	ModeratorScoringChangedEvent    = "ModeratorScoringChanged"
+)
+
+type Event struct {
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schemaVersion"`
+	TxID          string          `json:"txId"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type MembershipEventPayload struct {
+	CommunityId string `json:"communityId"`
+	UserId      string `json:"userId"`
+}
+
+type VoteEventPayload struct {
+	ItemId     string `json:"itemId"`
+	Voter      string `json:"voter"`
+	Direction  int    `json:"direction"` // 1 for upvote, -1 for downvote, 0 once the vote is undone
+	ScoreDelta int    `json:"scoreDelta"`
+}
+
+type ContentEventPayload struct {
+	ItemId      string `json:"itemId"`
+	ItemType    string `json:"itemType"`
+	CommunityId string `json:"communityId"`
+	UserId      string `json:"userId"`
+	Vote        string `json:"vote,omitempty"`   // "hide" or "show" for moderation votes
+	Rule        int    `json:"rule,omitempty"`   // community rule cited by a hide vote
+	CaseId      string `json:"caseId,omitempty"` // moderation case a moderation vote was cast on
+}
+
+type ModeratorsEventPayload struct {
+	CommunityId string   `json:"communityId"`
+	Moderators  []string `json:"moderators"`
+}
+
+/*
+Wraps the payload in the versioned event envelope and attaches it to the transaction.
+Listeners receive it once the transaction is committed.
+*/
+func emitEvent(ctx contractapi.TransactionContextInterface, eventType string, payload interface{}) error {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	event := Event{
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     timestamp,
+		Payload:       payloadJson,
+	}
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().SetEvent(eventType, eventJson)
+	if err != nil {
+		return fmt.Errorf("failed to set %s event: %w", eventType, err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Longest flair text a community can define
+const MaxFlairLength = 32
+
+/*
+A flair/tag from a community's catalog. Posts refer to it by Id, so renaming or recolouring
+a flair applies to every post that carries it.
+*/
+type Flair struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Color string `json:"color"` //hex colour such as #ff4500, optional
+}
+
+type FlairEventPayload struct {
+	CommunityId string  `json:"communityId"`
+	UserId      string  `json:"userId"`
+	Flairs      []Flair `json:"flairs"`
+}
+
+func findFlair(flairs []Flair, flairId string) int {
+	for i, flair := range flairs {
+		if flair.ID == flairId {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+Flair texts are compared case insensitively, so a community can't define the same flair twice
+and feeds can be filtered by flair text across communities.
+*/
+func sameFlairText(a string, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+func validateFlair(flairs []Flair, flairId string, text string, color string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("Flair text can't be empty")
+	}
+	if len(text) > MaxFlairLength {
+		return fmt.Errorf("Flair text can't be longer than %d characters", MaxFlairLength)
+	}
+	if color != "" && !isHexColor(color) {
+		return fmt.Errorf("Invalid flair color %s", color)
+	}
+	for _, flair := range flairs {
+		if flair.ID != flairId && sameFlairText(flair.Text, text) {
+			return fmt.Errorf("Flair %s already exists", text)
+		}
+	}
+	return nil
+}
+
+func isHexColor(color string) bool {
+	if len(color) != 7 || color[0] != '#' {
+		return false
+	}
+	for _, c := range color[1:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Loads a community and checks that the user is one of its moderators, who alone can edit its settings and manage its join requests.
+*/
+func (s *SmartContract) getModeratedCommunity(ctx contractapi.TransactionContextInterface, communityId string, userId string) (*Community, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(existingCommunity.Moderators, userId) {
+		return nil, fmt.Errorf("User cannot edit the community as you are not a moderator")
+	}
+	return existingCommunity, nil
+}
+
+func (s *SmartContract) saveFlairs(ctx contractapi.TransactionContextInterface, community *Community, userId string) error {
+	communityJson, _ := json.Marshal(community)
+	putState(ctx, communityObjectType, community.ID, communityJson)
+	return emitEvent(ctx, FlairsChangedEvent, FlairEventPayload{CommunityId: community.ID, UserId: userId, Flairs: community.Flairs})
+}
+
+/*
+Adds a flair to a community's catalog. Only moderators of the community can add flairs.
+The flair's Id is derived from the transaction and the added flair is returned.
+*/
+func (s *SmartContract) AddFlair(ctx contractapi.TransactionContextInterface, communityId string, text string, color string, userId string) (*Flair, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	id := newEntityId(ctx, "f")
+	err = validateFlair(existingCommunity.Flairs, id, text, color)
+	if err != nil {
+		return nil, err
+	}
+	flair := Flair{
+		ID:    id,
+		Text:  strings.TrimSpace(text),
+		Color: color,
+	}
+	existingCommunity.Flairs = append(existingCommunity.Flairs, flair)
+	err = s.saveFlairs(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &flair, nil
+}
+
+/*
+Changes the text and colour of a flair in a community's catalog. Only moderators of the community can edit flairs.
+*/
+func (s *SmartContract) UpdateFlair(ctx contractapi.TransactionContextInterface, communityId string, flairId string, text string, color string, userId string) (*Flair, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	index := findFlair(existingCommunity.Flairs, flairId)
+	if index == -1 {
+		return nil, fmt.Errorf("Flair with ID %s doesn't exists", flairId)
+	}
+	err = validateFlair(existingCommunity.Flairs, flairId, text, color)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity.Flairs[index].Text = strings.TrimSpace(text)
+	existingCommunity.Flairs[index].Color = color
+	flair := existingCommunity.Flairs[index]
+	err = s.saveFlairs(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &flair, nil
+}
+
+/*
+Removes a flair from a community's catalog. Only moderators of the community can remove flairs.
+Posts that carried it are shown without flair.
+*/
+func (s *SmartContract) RemoveFlair(ctx contractapi.TransactionContextInterface, communityId string, flairId string, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	index := findFlair(existingCommunity.Flairs, flairId)
+	if index == -1 {
+		return fmt.Errorf("Flair with ID %s doesn't exists", flairId)
+	}
+	existingCommunity.Flairs = append(existingCommunity.Flairs[:index], existingCommunity.Flairs[index+1:]...)
+	return s.saveFlairs(ctx, existingCommunity, userId)
+}
+
+/*
+Returns the flair catalog of a community, in the order the flairs were added.
+*/
+func (s *SmartContract) GetCommunityFlairs(ctx contractapi.TransactionContextInterface, communityId string) ([]Flair, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	if existingCommunity.Flairs == nil {
+		return make([]Flair, 0), nil
+	}
+	return existingCommunity.Flairs, nil
+}
+
+/*
+Returns the flair of a post from its community's catalog, or nil if the post has none or its flair was removed.
+*/
+func postFlair(post *Post, community *Community) *Flair {
+	if post.Flair == "" {
+		return nil
+	}
+	index := findFlair(community.Flairs, post.Flair)
+	if index == -1 {
+		return nil
+	}
+	flair := community.Flairs[index]
+	return &flair
+}
+
+/*
+Wraps an accept function for scanIndexes so that it also requires the post's flair text to match flair.
+An empty flair accepts every post. Community catalogs are cached in communities.
+*/
+func (s *SmartContract) flairFilter(ctx contractapi.TransactionContextInterface, flair string, posts map[string]*Post, accept func(string) (bool, error)) func(string) (bool, error) {
+	if flair == "" {
+		return accept
+	}
+	communities := make(map[string]*Community)
+	return func(postId string) (bool, error) {
+		accepted, err := accept(postId)
+		if err != nil || !accepted {
+			return false, err
+		}
+		post := posts[postId]
+		community, ok := communities[post.Community]
+		if !ok {
+			community, err = s.GetCommunity(ctx, post.Community)
+			if err != nil {
+				return false, err
+			}
+			communities[post.Community] = community
+		}
+		current := postFlair(post, community)
+		return current != nil && sameFlairText(current.Text, flair), nil
+	}
+}
@@ -0,0 +1,253 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A follow is recorded under (follow, follower, followee), holding the sort key it was indexed under,
+// and in two time-ordered indexes: the followee's followers and the follower's followed users.
+const (
+	followObjectType = "follow"
+	followerIndex    = "followerIndex"
+	followingIndex   = "followingIndex"
+)
+
+// Delta keys that aggregate follower and following counts, so that concurrent follows don't conflict on the User record
+const (
+	followerDeltaObjectType  = "followerDelta"
+	followingDeltaObjectType = "followingDelta"
+)
+
+// Feeds that GetUserFeed can return
+const (
+	FeedCommunities = "communities"
+	FeedFollowing   = "following"
+)
+
+const UsersPerPage = 20
+
+type UserPage struct {
+	Users      []*UserModified `json:"users"`
+	NextCursor string          `json:"nextCursor"` //empty on the last page
+}
+
+type FollowEventPayload struct {
+	Follower string `json:"follower"`
+	Followee string `json:"followee"`
+}
+
+func followKey(ctx contractapi.TransactionContextInterface, followerId string, followeeId string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(followObjectType, []string{followerId, followeeId})
+}
+
+/*
+Lets a user follow another user, whose posts then appear in the user's following feed.
+*/
+func (s *SmartContract) FollowUser(ctx contractapi.TransactionContextInterface, userId string, targetUserId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if userId == targetUserId {
+		return fmt.Errorf("User cannot follow themselves")
+	}
+	targetUser, err := s.GetUser(ctx, targetUserId)
+	if err != nil {
+		return err
+	}
+	if targetUser == nil {
+		return fmt.Errorf("User with ID %s doesn't exists", targetUserId)
+	}
+	key, err := followKey(ctx, userId, targetUserId)
+	if err != nil {
+		return err
+	}
+	existingFollow, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read follow from ledger: %w", err)
+	}
+	if existingFollow != nil {
+		return fmt.Errorf("User with ID %s already follows user %s", userId, targetUserId)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(key, []byte(indexSortKey(currentTime)))
+	if err != nil {
+		return err
+	}
+	err = putIndexEntry(ctx, followerIndex, targetUserId, currentTime, userId)
+	if err != nil {
+		return err
+	}
+	err = putIndexEntry(ctx, followingIndex, userId, currentTime, targetUserId)
+	if err != nil {
+		return err
+	}
+	err = putDelta(ctx, followerDeltaObjectType, targetUserId, 1)
+	if err != nil {
+		return err
+	}
+	err = putDelta(ctx, followingDeltaObjectType, userId, 1)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, UserFollowedEvent, FollowEventPayload{Follower: userId, Followee: targetUserId})
+}
+
+/*
+Stops a user from following another user.
+*/
+func (s *SmartContract) UnfollowUser(ctx contractapi.TransactionContextInterface, userId string, targetUserId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	key, err := followKey(ctx, userId, targetUserId)
+	if err != nil {
+		return err
+	}
+	sortKey, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read follow from ledger: %w", err)
+	}
+	if sortKey == nil {
+		return fmt.Errorf("User with ID %s doesn't follow user %s", userId, targetUserId)
+	}
+	followerKey, err := ctx.GetStub().CreateCompositeKey(followerIndex, []string{targetUserId, string(sortKey), userId})
+	if err != nil {
+		return err
+	}
+	followingKey, err := ctx.GetStub().CreateCompositeKey(followingIndex, []string{userId, string(sortKey), targetUserId})
+	if err != nil {
+		return err
+	}
+	for _, deletedKey := range []string{key, followerKey, followingKey} {
+		err = ctx.GetStub().DelState(deletedKey)
+		if err != nil {
+			return err
+		}
+	}
+	err = putDelta(ctx, followerDeltaObjectType, targetUserId, -1)
+	if err != nil {
+		return err
+	}
+	err = putDelta(ctx, followingDeltaObjectType, userId, -1)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, UserUnfollowedEvent, FollowEventPayload{Follower: userId, Followee: targetUserId})
+}
+
+/*
+Returns whether a user follows another user.
+*/
+func (s *SmartContract) IsFollowing(ctx contractapi.TransactionContextInterface, userId string, targetUserId string) (bool, error) {
+	key, err := followKey(ctx, userId, targetUserId)
+	if err != nil {
+		return false, err
+	}
+	existingFollow, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read follow from ledger: %w", err)
+	}
+	return existingFollow != nil, nil
+}
+
+/*
+Returns the Ids of every user the given user follows.
+*/
+func getFollowedIds(ctx contractapi.TransactionContextInterface, userId string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(followingIndex, []string{userId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	followedIds := make([]string, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(attributes) == 3 {
+			followedIds = append(followedIds, attributes[2])
+		}
+	}
+	return followedIds, nil
+}
+
+/*
+Pages through a user's followers or followed users, most recent first.
+*/
+func (s *SmartContract) userPage(ctx contractapi.TransactionContextInterface, indexType string, userId string, cursor string) (*UserPage, error) {
+	existingUser, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", userId)
+	}
+	entries, err := scanIndexes(ctx, indexType, []string{userId}, cursor, UsersPerPage+1, func(string) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, UsersPerPage)
+	page := UserPage{
+		Users:      make([]*UserModified, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		userModified, err := s.GetUserModified(ctx, entry.itemId)
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, userModified)
+	}
+	return &page, nil
+}
+
+/*
+Returns a page of the users following the given user, most recent first.
+*/
+func (s *SmartContract) GetFollowers(ctx contractapi.TransactionContextInterface, userId string, cursor string) (*UserPage, error) {
+	return s.userPage(ctx, followerIndex, userId, cursor)
+}
+
+/*
+Returns a page of the users the given user follows, most recently followed first.
+*/
+func (s *SmartContract) GetFollowing(ctx contractapi.TransactionContextInterface, userId string, cursor string) (*UserPage, error) {
+	return s.userPage(ctx, followingIndex, userId, cursor)
+}
+
+/*
+Wraps an accept function for a following feed so that a cross-post is skipped when the original's author is followed too,
+since the original already appears in the feed.
+*/
+func (s *SmartContract) dedupeFollowedCrossPosts(ctx contractapi.TransactionContextInterface, authorIds []string, posts map[string]*Post, accept func(string) (bool, error)) func(string) (bool, error) {
+	return func(postId string) (bool, error) {
+		accepted, err := accept(postId)
+		if err != nil || !accepted {
+			return false, err
+		}
+		post := posts[postId]
+		if post.CrossPostOf == "" {
+			return true, nil
+		}
+		originalPost, err := s.GetPost(ctx, post.CrossPostOf)
+		if err != nil {
+			return false, err
+		}
+		return !contains(authorIds, originalPost.Author), nil
+	}
+}
@@ -0,0 +1,131 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+A committed version of a post, comment, community or user, as recorded by the ledger's history database.
+Only the field matching ItemType is set, and none of them is set for a deletion.
+*/
+type HistoryEntry struct {
+	TxID      string     `json:"txId"`
+	Timestamp time.Time  `json:"timestamp"`
+	IsDelete  bool       `json:"isDelete"`
+	ItemType  string     `json:"itemType"`
+	Post      *Post      `json:"post,omitempty" metadata:",optional"`
+	Comment   *Comment   `json:"comment,omitempty" metadata:",optional"`
+	Community *Community `json:"community,omitempty" metadata:",optional"`
+	User      *User      `json:"user,omitempty" metadata:",optional"`
+}
+
+/*
+Checks that the user can read the history of an item of the given type. The history of a post, comment or community,
+including versions that were later hidden, is only for the moderators of its community; a user's history is only for that user.
+*/
+func (s *SmartContract) checkHistoryReadable(ctx contractapi.TransactionContextInterface, itemType string, id string, userId string) error {
+	communityId := id
+	switch itemType {
+	case postObjectType:
+		existingPost, err := s.GetPost(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existingPost == nil {
+			return fmt.Errorf("Post with ID %s doesn't exists", id)
+		}
+		communityId = existingPost.Community
+	case commentObjectType:
+		existingComment, err := s.GetComment(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existingComment == nil {
+			return fmt.Errorf("Comment with ID %s doesn't exists", id)
+		}
+		communityId = existingComment.Community
+	case communityObjectType:
+	case userObjectType:
+		if id != userId {
+			return fmt.Errorf("User cannot read the history of user %s", id)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Invalid item type %s", itemType)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return err
+	}
+	if !contains(existingCommunity.Moderators, userId) {
+		return fmt.Errorf("User cannot read the history as you are not a moderator")
+	}
+	return nil
+}
+
+/*
+Returns every committed version of a post, comment, community or user, in the order the ledger recorded them,
+with the transaction that wrote it, when it was written and whether it was a deletion.
+It takes the item type ("post", "comment", "community" or "user"), the item Id and user Id as parameters.
+Lets moderators and appeal reviewers see what an item said before it was deleted or hidden; who can read it is described in checkHistoryReadable.
+*/
+func (s *SmartContract) GetItemHistory(ctx contractapi.TransactionContextInterface, itemType string, id string, userId string) ([]*HistoryEntry, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkHistoryReadable(ctx, itemType, id, userId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := entityKey(ctx, itemType, id)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of %s from ledger: %w", id, err)
+	}
+	defer resultsIterator.Close()
+
+	history := make([]*HistoryEntry, 0)
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		entry := HistoryEntry{
+			TxID:     modification.TxId,
+			IsDelete: modification.IsDelete,
+			ItemType: itemType,
+		}
+		if modification.Timestamp != nil {
+			entry.Timestamp = modification.Timestamp.AsTime()
+		}
+		if !modification.IsDelete {
+			switch itemType {
+			case postObjectType:
+				entry.Post = &Post{}
+				err = json.Unmarshal(modification.Value, entry.Post)
+			case commentObjectType:
+				entry.Comment = &Comment{}
+				err = json.Unmarshal(modification.Value, entry.Comment)
+			case communityObjectType:
+				entry.Community = &Community{}
+				err = json.Unmarshal(modification.Value, entry.Community)
+			case userObjectType:
+				entry.User = &User{}
+				err = json.Unmarshal(modification.Value, entry.User)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, &entry)
+	}
+	return history, nil
+}
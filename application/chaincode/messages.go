@@ -0,0 +1,445 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Private data collection holding direct messages, defined in collections_config.json.
+// Only a salted hash of each message body is written to the public world state. The collection requires the body to reach
+// another peer before endorsement succeeds, so losing the endorsing peer can't lose a message whose hash was committed.
+const directMessageCollection = "directMessageCollection"
+
+// Object types of direct messages. Within the collection a message is stored under
+// (directMessage, lower user Id, higher user Id, sort key, message Id), so both participants share one
+// time-ordered conversation, and each participant has a conversation record and an inbox entry keyed by the other user.
+// The public ledger only holds (messageHash, message Id).
+const (
+	directMessageObjectType = "directMessage"
+	conversationObjectType  = "conversation"
+	inboxIndex              = "inboxIndex"
+	messageHashObjectType   = "messageHash"
+)
+
+// Keys of the transient fields that carry a message's recipient, body and salt, so none ends up in the transaction recorded on the ledger
+const (
+	messageRecipientTransientKey = "recipientId"
+	messageBodyTransientKey      = "body"
+	messageSaltTransientKey      = "salt"
+)
+
+const (
+	MaxMessageLength     = 2000
+	MinMessageSaltLength = 16 //bytes of random salt hashed with each message body
+	MessagesPerPage      = 20
+	ConversationsPerPage = 20
+	messagePreviewLength = 100
+)
+
+type DirectMessage struct {
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	Recipient string    `json:"recipient"`
+	Body      string    `json:"body"`
+	Salt      string    `json:"salt"`     //hex random salt the sender supplied, hashed with the body
+	BodyHash  string    `json:"bodyHash"` //hex SHA-256 of the salt followed by the body, as recorded on the public ledger
+	SentAt    time.Time `json:"sentAt"`
+}
+
+/*
+A user's side of a conversation with another user.
+*/
+type Conversation struct {
+	UserId        string    `json:"userId"`
+	OtherUserId   string    `json:"otherUserId"`
+	LastMessageId string    `json:"lastMessageId"`
+	LastMessage   string    `json:"lastMessage"` //preview of the last message's body
+	LastMessageAt time.Time `json:"lastMessageAt"`
+	LastReadAt    time.Time `json:"lastReadAt"`
+	Unread        int       `json:"unread"`
+	OtherUsername string    `json:"otherUsername" metadata:",optional"`
+}
+
+type ConversationPage struct {
+	Conversations []*Conversation `json:"conversations"`
+	NextCursor    string          `json:"nextCursor"` //empty on the last page
+}
+
+type MessagePage struct {
+	Messages   []*DirectMessage `json:"messages"`
+	NextCursor string           `json:"nextCursor"` //empty on the last page
+}
+
+type MessageEventPayload struct {
+	MessageId string `json:"messageId"`
+	BodyHash  string `json:"bodyHash"`
+}
+
+/*
+Both participants of a conversation address it by the same pair of user Ids, lower Id first.
+*/
+func conversationParticipants(userId string, otherUserId string) []string {
+	if userId < otherUserId {
+		return []string{userId, otherUserId}
+	}
+	return []string{otherUserId, userId}
+}
+
+/*
+Hashes a message body with its salt, so short or predictable bodies can't be recovered from the public hash by guessing.
+*/
+func messageBodyHash(salt []byte, body string) string {
+	hash := sha256.Sum256(append(append([]byte{}, salt...), body...))
+	return hex.EncodeToString(hash[:])
+}
+
+/*
+Decodes a hex message salt, which must hold at least MinMessageSaltLength bytes.
+*/
+func parseMessageSalt(salt string) ([]byte, error) {
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil || len(saltBytes) < MinMessageSaltLength {
+		return nil, fmt.Errorf("Message salt must be at least %d random bytes, hex encoded", MinMessageSaltLength)
+	}
+	return saltBytes, nil
+}
+
+func messagePreview(body string) string {
+	if len(body) <= messagePreviewLength {
+		return body
+	}
+	return strings.ToValidUTF8(body[:messagePreviewLength], "") + "..."
+}
+
+/*
+Reads a required field from the transient data.
+*/
+func transientField(ctx contractapi.TransactionContextInterface, key string) (string, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transient data: %w", err)
+	}
+	value := string(transientMap[key])
+	if value == "" {
+		return "", fmt.Errorf("%s must be passed in the transient data", key)
+	}
+	return value, nil
+}
+
+func (s *SmartContract) getConversation(ctx contractapi.TransactionContextInterface, userId string, otherUserId string) (*Conversation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(conversationObjectType, []string{userId, otherUserId})
+	if err != nil {
+		return nil, err
+	}
+	conversationJson, err := ctx.GetStub().GetPrivateData(directMessageCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation: %w", err)
+	}
+	if conversationJson == nil {
+		return nil, nil
+	}
+	var conversation Conversation
+	err = json.Unmarshal(conversationJson, &conversation)
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+/*
+Stores a user's side of a conversation and moves it to the top of the user's inbox.
+previousMessageAt is when the conversation was last moved, zero for a new conversation.
+*/
+func putConversation(ctx contractapi.TransactionContextInterface, conversation *Conversation, previousMessageAt time.Time) error {
+	if !previousMessageAt.IsZero() {
+		previousKey, err := ctx.GetStub().CreateCompositeKey(inboxIndex, []string{conversation.UserId, indexSortKey(previousMessageAt), conversation.OtherUserId})
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelPrivateData(directMessageCollection, previousKey)
+		if err != nil {
+			return err
+		}
+	}
+	inboxKey, err := ctx.GetStub().CreateCompositeKey(inboxIndex, []string{conversation.UserId, indexSortKey(conversation.LastMessageAt), conversation.OtherUserId})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(directMessageCollection, inboxKey, []byte{0x00})
+	if err != nil {
+		return err
+	}
+	return saveConversation(ctx, conversation)
+}
+
+func saveConversation(ctx contractapi.TransactionContextInterface, conversation *Conversation) error {
+	key, err := ctx.GetStub().CreateCompositeKey(conversationObjectType, []string{conversation.UserId, conversation.OtherUserId})
+	if err != nil {
+		return err
+	}
+	conversationJson, _ := json.Marshal(conversation)
+	return ctx.GetStub().PutPrivateData(directMessageCollection, key, conversationJson)
+}
+
+/*
+Records a new message on the sender's and the recipient's side of their conversation, creating it on first message.
+The recipient's unread count goes up; the sender's side is marked read up to the message.
+*/
+func (s *SmartContract) deliverMessage(ctx contractapi.TransactionContextInterface, message *DirectMessage, userId string, otherUserId string) error {
+	conversation, err := s.getConversation(ctx, userId, otherUserId)
+	if err != nil {
+		return err
+	}
+	previousMessageAt := time.Time{}
+	if conversation == nil {
+		conversation = &Conversation{UserId: userId, OtherUserId: otherUserId}
+	} else {
+		previousMessageAt = conversation.LastMessageAt
+	}
+	conversation.LastMessageId = message.ID
+	conversation.LastMessage = messagePreview(message.Body)
+	conversation.LastMessageAt = message.SentAt
+	if userId == message.Sender {
+		conversation.LastReadAt = message.SentAt
+		conversation.Unread = 0
+	} else {
+		conversation.Unread++
+	}
+	return putConversation(ctx, conversation, previousMessageAt)
+}
+
+/*
+Sends a direct message from the user to another user. The recipient's Id, the message body and a random salt of at least
+MinMessageSaltLength bytes, hex encoded, are passed in the transient data under "recipientId", "body" and "salt".
+The message and its salt are kept in the direct message collection; only the SHA-256 hash of the salt followed by the body
+is written to the public world state, under the message's Id, which is returned.
+*/
+func (s *SmartContract) SendMessage(ctx contractapi.TransactionContextInterface, userId string) (string, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	recipientId, err := transientField(ctx, messageRecipientTransientKey)
+	if err != nil {
+		return "", err
+	}
+	body, err := transientField(ctx, messageBodyTransientKey)
+	if err != nil {
+		return "", err
+	}
+	salt, err := transientField(ctx, messageSaltTransientKey)
+	if err != nil {
+		return "", err
+	}
+	saltBytes, err := parseMessageSalt(salt)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(body) == "" {
+		return "", fmt.Errorf("Message can't be empty")
+	}
+	if len(body) > MaxMessageLength {
+		return "", fmt.Errorf("Message can't be longer than %d characters", MaxMessageLength)
+	}
+	if recipientId == userId {
+		return "", fmt.Errorf("User cannot message themselves")
+	}
+	recipient, err := s.GetUser(ctx, recipientId)
+	if err != nil {
+		return "", err
+	}
+	if recipient == nil {
+		return "", fmt.Errorf("User with ID %s doesn't exists", recipientId)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	message := DirectMessage{
+		ID:        newEntityId(ctx, "m"),
+		Sender:    userId,
+		Recipient: recipientId,
+		Body:      body,
+		Salt:      salt,
+		BodyHash:  messageBodyHash(saltBytes, body),
+		SentAt:    currentTime,
+	}
+	messageKey, err := ctx.GetStub().CreateCompositeKey(directMessageObjectType, append(conversationParticipants(userId, recipientId), indexSortKey(currentTime), message.ID))
+	if err != nil {
+		return "", err
+	}
+	messageJson, _ := json.Marshal(message)
+	err = ctx.GetStub().PutPrivateData(directMessageCollection, messageKey, messageJson)
+	if err != nil {
+		return "", err
+	}
+	err = s.deliverMessage(ctx, &message, userId, recipientId)
+	if err != nil {
+		return "", err
+	}
+	err = s.deliverMessage(ctx, &message, recipientId, userId)
+	if err != nil {
+		return "", err
+	}
+	err = putState(ctx, messageHashObjectType, message.ID, []byte(message.BodyHash))
+	if err != nil {
+		return "", err
+	}
+	err = emitEvent(ctx, MessageSentEvent, MessageEventPayload{MessageId: message.ID, BodyHash: message.BodyHash})
+	if err != nil {
+		return "", err
+	}
+	return message.ID, nil
+}
+
+/*
+Marks the user's conversation with another user as read. The other user's Id is passed in the transient data under "recipientId".
+*/
+func (s *SmartContract) MarkConversationRead(ctx contractapi.TransactionContextInterface, userId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	otherUserId, err := transientField(ctx, messageRecipientTransientKey)
+	if err != nil {
+		return err
+	}
+	conversation, err := s.getConversation(ctx, userId, otherUserId)
+	if err != nil {
+		return err
+	}
+	if conversation == nil {
+		return fmt.Errorf("User with ID %s has no conversation with user %s", userId, otherUserId)
+	}
+	if conversation.Unread == 0 {
+		return nil
+	}
+	conversation.LastReadAt = conversation.LastMessageAt
+	conversation.Unread = 0
+	return saveConversation(ctx, conversation)
+}
+
+/*
+Returns the user's conversations, most recently active first, with each one's unread count. Only the user can read them.
+*/
+func (s *SmartContract) GetConversations(ctx contractapi.TransactionContextInterface, userId string, cursor string) (*ConversationPage, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanPrivateIndex(ctx, directMessageCollection, inboxIndex, []string{userId}, cursor, ConversationsPerPage+1, func(indexEntry, []byte) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, ConversationsPerPage)
+	page := ConversationPage{
+		Conversations: make([]*Conversation, 0, len(entries)),
+		NextCursor:    nextCursor,
+	}
+	for _, entry := range entries {
+		conversation, err := s.getConversation(ctx, userId, entry.itemId)
+		if err != nil {
+			return nil, err
+		}
+		if conversation == nil {
+			continue
+		}
+		otherUser, err := s.GetUser(ctx, entry.itemId)
+		if err != nil {
+			return nil, err
+		}
+		if otherUser != nil {
+			conversation.OtherUsername = otherUser.Username
+		}
+		page.Conversations = append(page.Conversations, conversation)
+	}
+	return &page, nil
+}
+
+/*
+Returns a page of the messages between the user and another user, newest first. Only a participant can read them.
+*/
+func (s *SmartContract) GetMessages(ctx contractapi.TransactionContextInterface, userId string, otherUserId string, cursor string) (*MessagePage, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	messages := make(map[string]*DirectMessage)
+	entries, err := scanPrivateIndex(ctx, directMessageCollection, directMessageObjectType, conversationParticipants(userId, otherUserId), cursor, MessagesPerPage+1, func(entry indexEntry, value []byte) (bool, error) {
+		var message DirectMessage
+		err := json.Unmarshal(value, &message)
+		if err != nil {
+			return false, err
+		}
+		messages[entry.itemId] = &message
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, MessagesPerPage)
+	page := MessagePage{
+		Messages:   make([]*DirectMessage, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		page.Messages = append(page.Messages, messages[entry.itemId])
+	}
+	return &page, nil
+}
+
+/*
+Returns the number of unread messages across all of the user's conversations.
+*/
+func (s *SmartContract) GetUnreadMessageCount(ctx contractapi.TransactionContextInterface, userId string) (int, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(directMessageCollection, conversationObjectType, []string{userId})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read conversations: %w", err)
+	}
+	defer resultsIterator.Close()
+
+	unread := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		var conversation Conversation
+		err = json.Unmarshal(queryResponse.Value, &conversation)
+		if err != nil {
+			return 0, err
+		}
+		unread += conversation.Unread
+	}
+	return unread, nil
+}
+
+/*
+Checks a message body and its salt, as kept with the message, against the hash recorded on the public ledger for the message's Id.
+*/
+func (s *SmartContract) VerifyMessage(ctx contractapi.TransactionContextInterface, messageId string, salt string, body string) (bool, error) {
+	saltBytes, err := parseMessageSalt(salt)
+	if err != nil {
+		return false, err
+	}
+	hash, err := getState(ctx, messageHashObjectType, messageId)
+	if err != nil {
+		return false, fmt.Errorf("failed to read message hash from ledger: %w", err)
+	}
+	if hash == nil {
+		return false, fmt.Errorf("Message with ID %s doesn't exists", messageId)
+	}
+	return string(hash) == messageBodyHash(saltBytes, body), nil
+}
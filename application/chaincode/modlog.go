@@ -0,0 +1,237 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Moderation log entries are stored under (modLogEntry, community, entry Id) and in the community's time-ordered log.
+// Entries are only ever added, never edited or removed.
+const (
+	modLogObjectType = "modLogEntry"
+	modLogIndex      = "modLogIndex"
+)
+
+// Moderation actions recorded in the log
+const (
+	ModActionHide            = "hide" //a moderator voted to hide a post or comment
+	ModActionShow            = "show" //a moderator voted to keep a post or comment
+	ModActionBan             = "ban"
+	ModActionUnban           = "unban"
+	ModActionAddModerator    = "addModerator"
+	ModActionRemoveModerator = "removeModerator"
+	ModActionExpire          = "expire" //a moderation case passed its deadline undecided
+)
+
+const ModLogEntriesPerPage = 20
+
+type ModLogEntry struct {
+	ID          string    `json:"id"`
+	CommunityId string    `json:"communityId"`
+	Action      string    `json:"action"`
+	Moderator   string    `json:"moderator"`                                 //empty for changes made by moderator selection and expired cases
+	TargetUser  string    `json:"targetUser,omitempty" metadata:",optional"` //banned user, changed moderator or author of the item
+	ItemId      string    `json:"itemId,omitempty" metadata:",optional"`
+	ItemType    string    `json:"itemType,omitempty" metadata:",optional"`
+	Rule        int       `json:"rule,omitempty" metadata:",optional"`      //community rule cited by a hide vote
+	Reason      string    `json:"reason,omitempty" metadata:",optional"`    //ban reason
+	ExpiresAt   string    `json:"expiresAt,omitempty" metadata:",optional"` //ban expiry, empty for a permanent ban
+	Outcome     string    `json:"outcome,omitempty" metadata:",optional"`   //"hidden" or "shown" when the vote decided the item
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type ModLogPage struct {
+	Entries    []*ModLogEntry `json:"entries"`
+	NextCursor string         `json:"nextCursor"` //empty on the last page
+}
+
+/*
+Appends entries to a community's moderation log. Entry Ids are derived from the transaction Id,
+numbered when a transaction logs more than one entry.
+*/
+func logModActions(ctx contractapi.TransactionContextInterface, communityId string, entries ...ModLogEntry) error {
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		entry.ID = newEntityId(ctx, "ml")
+		if len(entries) > 1 {
+			entry.ID += "_" + strconv.Itoa(i)
+		}
+		entry.CommunityId = communityId
+		entry.CreatedAt = currentTime
+		key, err := ctx.GetStub().CreateCompositeKey(modLogObjectType, []string{communityId, entry.ID})
+		if err != nil {
+			return err
+		}
+		entryJson, _ := json.Marshal(entry)
+		err = ctx.GetStub().PutState(key, entryJson)
+		if err != nil {
+			return err
+		}
+		err = putIndexEntry(ctx, modLogIndex, communityId, currentTime, entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SmartContract) getModLogEntry(ctx contractapi.TransactionContextInterface, communityId string, entryId string) (*ModLogEntry, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(modLogObjectType, []string{communityId, entryId})
+	if err != nil {
+		return nil, err
+	}
+	entryJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation log from ledger: %w", err)
+	}
+	if entryJson == nil {
+		return nil, nil
+	}
+	var entry ModLogEntry
+	err = json.Unmarshal(entryJson, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+/*
+Records the moderators added and removed when a community's moderator list is replaced.
+*/
+func logModeratorChanges(ctx contractapi.TransactionContextInterface, communityId string, moderator string, previous []string, current []string) error {
+	var entries []ModLogEntry
+	for _, userId := range current {
+		if !contains(previous, userId) {
+			entries = append(entries, ModLogEntry{Action: ModActionAddModerator, Moderator: moderator, TargetUser: userId})
+		}
+	}
+	for _, userId := range previous {
+		if !contains(current, userId) {
+			entries = append(entries, ModLogEntry{Action: ModActionRemoveModerator, Moderator: moderator, TargetUser: userId})
+		}
+	}
+	return logModActions(ctx, communityId, entries...)
+}
+
+/*
+Makes a member of a community one of its moderators. Only existing moderators of the community can add moderators,
+and banned users can't be added. Appointed moderators stay through SelectModerator until they are removed.
+*/
+func (s *SmartContract) AddModerator(ctx contractapi.TransactionContextInterface, communityId string, targetUserId string, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	if contains(existingCommunity.Moderators, targetUserId) {
+		return fmt.Errorf("User with ID %s is already a moderator of community %s", targetUserId, communityId)
+	}
+	if !contains(existingCommunity.Users, targetUserId) {
+		return fmt.Errorf("User with ID %s is not a member of community %s", targetUserId, communityId)
+	}
+	err = s.checkNotBanned(ctx, communityId, targetUserId)
+	if err != nil {
+		return err
+	}
+	existingCommunity.Moderators = append(existingCommunity.Moderators, targetUserId)
+	existingCommunity.Appointed = append(existingCommunity.Appointed, targetUserId)
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	err = logModActions(ctx, communityId, ModLogEntry{Action: ModActionAddModerator, Moderator: userId, TargetUser: targetUserId})
+	if err != nil {
+		return err
+	}
+	err = s.notify(ctx, targetUserId, NotificationModerator, userId, "", "", communityId, 0)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, ModeratorsChangedEvent, ModeratorsEventPayload{CommunityId: communityId, Moderators: existingCommunity.Moderators})
+}
+
+/*
+Removes a moderator of a community; moderators can also step down themselves. Only moderators of the community can remove moderators,
+and the last moderator can't be removed.
+*/
+func (s *SmartContract) RemoveModerator(ctx contractapi.TransactionContextInterface, communityId string, targetUserId string, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	index := findIndex(existingCommunity.Moderators, targetUserId)
+	if index == -1 {
+		return fmt.Errorf("User with ID %s is not a moderator of community %s", targetUserId, communityId)
+	}
+	if len(existingCommunity.Moderators) == 1 {
+		return fmt.Errorf("The last moderator of community %s cannot be removed", communityId)
+	}
+	existingCommunity.Moderators = removeElement(existingCommunity.Moderators, index)
+	if index := findIndex(existingCommunity.Appointed, targetUserId); index != -1 {
+		existingCommunity.Appointed = removeElement(existingCommunity.Appointed, index)
+	}
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	err = logModActions(ctx, communityId, ModLogEntry{Action: ModActionRemoveModerator, Moderator: userId, TargetUser: targetUserId})
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, ModeratorsChangedEvent, ModeratorsEventPayload{CommunityId: communityId, Moderators: existingCommunity.Moderators})
+}
+
+/*
+Adds the moderators appointed through AddModerator who are still moderators and eligible members to a new moderator list,
+so that selections and elections keep them. Returns the list and the appointed moderators kept.
+*/
+func (s *SmartContract) keepAppointedModerators(ctx contractapi.TransactionContextInterface, community *Community, moderators []string) ([]string, []string) {
+	var appointed []string
+	for _, moderator := range community.Appointed {
+		if !contains(community.Moderators, moderator) || s.checkEligibleMember(ctx, community, moderator) != nil {
+			continue
+		}
+		appointed = append(appointed, moderator)
+		if !contains(moderators, moderator) {
+			moderators = append(moderators, moderator)
+		}
+	}
+	return moderators, appointed
+}
+
+/*
+Returns a page of a community's moderation log, newest first. Anyone who can read the community can read its log.
+*/
+func (s *SmartContract) GetModLog(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string) (*ModLogPage, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	logEntries := make(map[string]*ModLogEntry)
+	entries, err := scanIndexes(ctx, modLogIndex, []string{communityId}, cursor, ModLogEntriesPerPage+1, func(entryId string) (bool, error) {
+		entry, err := s.getModLogEntry(ctx, communityId, entryId)
+		if err != nil || entry == nil {
+			return false, err
+		}
+		logEntries[entryId] = entry
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, ModLogEntriesPerPage)
+	page := ModLogPage{
+		Entries:    make([]*ModLogEntry, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		page.Entries = append(page.Entries, logEntries[entry.itemId])
+	}
+	return &page, nil
+}
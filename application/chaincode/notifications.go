@@ -0,0 +1,318 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A notification is stored under (notification, recipient, notification Id) and in the recipient's time-ordered index.
+// Unread counts are kept as deltas, so notifying a user never conflicts with the user reading their notifications.
+const (
+	notificationObjectType            = "notification"
+	notificationIndex                 = "notificationIndex"
+	unreadNotificationDeltaObjectType = "unreadNotificationDelta"
+	notificationPreferencesObjectType = "notificationPreferences"
+)
+
+// Notification types
+const (
+	NotificationReply         = "reply"         //someone commented on the user's post or replied to their comment
+	NotificationContentHidden = "contentHidden" //moderators hid the user's post or comment
+	NotificationModerator     = "moderator"     //the user was selected as a moderator of a community
+)
+
+var notificationTypes = []string{NotificationReply, NotificationContentHidden, NotificationModerator}
+
+const NotificationsPerPage = 20
+
+type Notification struct {
+	ID          string    `json:"id"`
+	Recipient   string    `json:"recipient"`
+	Type        string    `json:"type"`
+	Actor       string    `json:"actor"`    //user who caused the notification, empty for moderation outcomes
+	ItemId      string    `json:"itemId"`   //post or comment the notification is about, empty for moderator selection
+	ItemType    string    `json:"itemType"` //"post" or "comment"
+	CommunityId string    `json:"communityId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Read        bool      `json:"read"`
+	Rule        int       `json:"rule,omitempty" metadata:",optional"` //community rule cited when content was hidden
+}
+
+type NotificationPage struct {
+	Notifications []*Notification `json:"notifications"`
+	Unread        int             `json:"unread"`
+	NextCursor    string          `json:"nextCursor"` //empty on the last page
+}
+
+/*
+The notification types a user has turned off. Every type is on by default.
+*/
+type NotificationPreferences struct {
+	UserId   string   `json:"userId"`
+	Disabled []string `json:"disabled"`
+}
+
+type NotificationsEventPayload struct {
+	UserId string `json:"userId"`
+}
+
+func (s *SmartContract) getNotificationPreferences(ctx contractapi.TransactionContextInterface, userId string) (*NotificationPreferences, error) {
+	preferencesJson, err := getState(ctx, notificationPreferencesObjectType, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification preferences from ledger: %w", err)
+	}
+	preferences := NotificationPreferences{UserId: userId, Disabled: make([]string, 0)}
+	if preferencesJson == nil {
+		return &preferences, nil
+	}
+	err = json.Unmarshal(preferencesJson, &preferences)
+	if err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+/*
+Adds a notification to the recipient's inbox, unless the recipient caused it or has turned its type off.
+Called by the transactions whose outcome a user should hear about; each recipient gets at most one notification per transaction.
+*/
+func (s *SmartContract) notify(ctx contractapi.TransactionContextInterface, recipient string, notificationType string, actor string, itemId string, itemType string, communityId string, rule int) error {
+	if recipient == "" || recipient == actor {
+		return nil
+	}
+	preferences, err := s.getNotificationPreferences(ctx, recipient)
+	if err != nil {
+		return err
+	}
+	if contains(preferences.Disabled, notificationType) {
+		return nil
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	notification := Notification{
+		ID:          newEntityId(ctx, "n"),
+		Recipient:   recipient,
+		Type:        notificationType,
+		Actor:       actor,
+		ItemId:      itemId,
+		ItemType:    itemType,
+		CommunityId: communityId,
+		CreatedAt:   currentTime,
+		Rule:        rule,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(notificationObjectType, []string{recipient, notification.ID})
+	if err != nil {
+		return err
+	}
+	notificationJson, _ := json.Marshal(notification)
+	err = ctx.GetStub().PutState(key, notificationJson)
+	if err != nil {
+		return err
+	}
+	err = putIndexEntry(ctx, notificationIndex, recipient, currentTime, notification.ID)
+	if err != nil {
+		return err
+	}
+	return putDelta(ctx, unreadNotificationDeltaObjectType, recipient, 1)
+}
+
+func (s *SmartContract) getNotification(ctx contractapi.TransactionContextInterface, userId string, notificationId string) (*Notification, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(notificationObjectType, []string{userId, notificationId})
+	if err != nil {
+		return nil, err
+	}
+	notificationJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification from ledger: %w", err)
+	}
+	if notificationJson == nil {
+		return nil, nil
+	}
+	var notification Notification
+	err = json.Unmarshal(notificationJson, &notification)
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+func saveNotification(ctx contractapi.TransactionContextInterface, notification *Notification) error {
+	key, err := ctx.GetStub().CreateCompositeKey(notificationObjectType, []string{notification.Recipient, notification.ID})
+	if err != nil {
+		return err
+	}
+	notificationJson, _ := json.Marshal(notification)
+	return ctx.GetStub().PutState(key, notificationJson)
+}
+
+/*
+Returns a page of the user's notifications, newest first, with the number of unread ones. Only the user can read them.
+With unreadOnly set, notifications that have been read are skipped.
+*/
+func (s *SmartContract) GetNotifications(ctx contractapi.TransactionContextInterface, userId string, cursor string, unreadOnly bool) (*NotificationPage, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	notifications := make(map[string]*Notification)
+	entries, err := scanIndexes(ctx, notificationIndex, []string{userId}, cursor, NotificationsPerPage+1, func(notificationId string) (bool, error) {
+		notification, err := s.getNotification(ctx, userId, notificationId)
+		if err != nil || notification == nil {
+			return false, err
+		}
+		notifications[notificationId] = notification
+		return !unreadOnly || !notification.Read, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	unread, err := sumDeltas(ctx, unreadNotificationDeltaObjectType, userId)
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, NotificationsPerPage)
+	page := NotificationPage{
+		Notifications: make([]*Notification, 0, len(entries)),
+		Unread:        unread,
+		NextCursor:    nextCursor,
+	}
+	for _, entry := range entries {
+		page.Notifications = append(page.Notifications, notifications[entry.itemId])
+	}
+	return &page, nil
+}
+
+/*
+Returns the number of the user's unread notifications.
+*/
+func (s *SmartContract) GetUnreadNotificationCount(ctx contractapi.TransactionContextInterface, userId string) (int, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	return sumDeltas(ctx, unreadNotificationDeltaObjectType, userId)
+}
+
+/*
+Marks one of the user's notifications as read.
+*/
+func (s *SmartContract) MarkNotificationRead(ctx contractapi.TransactionContextInterface, userId string, notificationId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	notification, err := s.getNotification(ctx, userId, notificationId)
+	if err != nil {
+		return err
+	}
+	if notification == nil {
+		return fmt.Errorf("Notification with ID %s doesn't exists", notificationId)
+	}
+	if notification.Read {
+		return nil
+	}
+	notification.Read = true
+	err = saveNotification(ctx, notification)
+	if err != nil {
+		return err
+	}
+	err = putDelta(ctx, unreadNotificationDeltaObjectType, userId, -1)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, NotificationsChangedEvent, NotificationsEventPayload{UserId: userId})
+}
+
+/*
+Marks every unread notification of the user as read.
+*/
+func (s *SmartContract) MarkAllNotificationsRead(ctx contractapi.TransactionContextInterface, userId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(notificationObjectType, []string{userId})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	marked := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var notification Notification
+		err = json.Unmarshal(queryResponse.Value, &notification)
+		if err != nil {
+			return err
+		}
+		if notification.Read {
+			continue
+		}
+		notification.Read = true
+		err = saveNotification(ctx, &notification)
+		if err != nil {
+			return err
+		}
+		marked++
+	}
+	if marked > 0 {
+		err = putDelta(ctx, unreadNotificationDeltaObjectType, userId, -marked)
+		if err != nil {
+			return err
+		}
+	}
+	return emitEvent(ctx, NotificationsChangedEvent, NotificationsEventPayload{UserId: userId})
+}
+
+/*
+Returns the notification types the user has turned off.
+*/
+func (s *SmartContract) GetNotificationPreferences(ctx contractapi.TransactionContextInterface, userId string) (*NotificationPreferences, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return s.getNotificationPreferences(ctx, userId)
+}
+
+/*
+Turns a notification type on or off for the user. Notifications already received are kept.
+*/
+func (s *SmartContract) SetNotificationPreference(ctx contractapi.TransactionContextInterface, userId string, notificationType string, enabled bool) (*NotificationPreferences, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(notificationTypes, notificationType) {
+		return nil, fmt.Errorf("Invalid notification type %s", notificationType)
+	}
+	preferences, err := s.getNotificationPreferences(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	index := findIndex(preferences.Disabled, notificationType)
+	if enabled && index != -1 {
+		preferences.Disabled = removeElement(preferences.Disabled, index)
+	}
+	if !enabled && index == -1 {
+		preferences.Disabled = append(preferences.Disabled, notificationType)
+	}
+	preferencesJson, _ := json.Marshal(preferences)
+	err = putState(ctx, notificationPreferencesObjectType, userId, preferencesJson)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, NotificationsChangedEvent, NotificationsEventPayload{UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
@@ -0,0 +1,441 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Index types for the time-ordered index keys that back cursor pagination.
+// An entry is stored under (index type, owner Id, sort key, item Id) with an empty value,
+// so a range scan over one owner returns its items newest first.
+const (
+	communityPostIndex = "communityPostIndex"
+	authorPostIndex    = "authorPostIndex"
+	childCommentIndex  = "childCommentIndex"
+	authorCommentIndex = "authorCommentIndex"
+)
+
+// Length of the sort key component of an index entry
+const sortKeyLength = 19
+
+// Returned by an accept function to end a scan early, once no later entry can be accepted
+var errEndOfScan = errors.New("end of scan")
+
+type PostPage struct {
+	Posts      []*PostModified `json:"posts"`
+	NextCursor string          `json:"nextCursor"` //empty on the last page
+}
+
+type CommentPage struct {
+	Comments   []*CommentModified `json:"comments"`
+	NextCursor string             `json:"nextCursor"` //empty on the last page
+}
+
+type PostOrCommentPage struct {
+	Items      []*PostOrComment `json:"items"`
+	NextCursor string           `json:"nextCursor"` //empty on the last page
+}
+
+type indexEntry struct {
+	sortKey  string
+	itemId   string
+	bookmark string       //bookmark of the index page the entry was read from, which resumes a scan at or before it
+	resume   *indexCursor //set by scanIndexes on the last entry it returns, so a cursor at it can resume every owner's scan
+}
+
+/*
+Where a scan over several owners' indexes resumes. Bookmarks are opaque to the chaincode, so rather than being built from
+the position they are the ones the state database returned: for each owner, the bookmark of the page holding its first
+entry at or after the position. Entries before the position on that page are skipped.
+*/
+type indexCursor struct {
+	SortKey   string            `json:"sortKey"`
+	ItemId    string            `json:"itemId"`
+	Bookmarks map[string]string `json:"bookmarks"`
+	Done      []string          `json:"done"` //owners whose index has no entry at or after the position
+}
+
+func (entry indexEntry) position() string {
+	return entry.sortKey + "_" + entry.itemId
+}
+
+/*
+A cursor names the first entry of the next page, so pages don't shift when newer items are added.
+Cursors of multi-owner scans also carry the owners' bookmarks, encoded as base64 JSON.
+*/
+func (entry indexEntry) cursor() string {
+	if entry.resume == nil {
+		return entry.position()
+	}
+	cursorJson, _ := json.Marshal(entry.resume)
+	return base64.RawURLEncoding.EncodeToString(cursorJson)
+}
+
+func parseCursor(cursor string) (indexEntry, error) {
+	if len(cursor) > sortKeyLength+1 && cursor[sortKeyLength] == '_' {
+		return indexEntry{sortKey: cursor[:sortKeyLength], itemId: cursor[sortKeyLength+1:]}, nil
+	}
+	var resume indexCursor
+	cursorJson, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(cursorJson, &resume)
+	}
+	if err != nil || len(resume.SortKey) != sortKeyLength {
+		return indexEntry{}, fmt.Errorf("Invalid cursor %s", cursor)
+	}
+	return indexEntry{sortKey: resume.SortKey, itemId: resume.ItemId, resume: &resume}, nil
+}
+
+/*
+Inverts the timestamp so that newer items sort first in a range scan.
+*/
+func indexSortKey(t time.Time) string {
+	return fmt.Sprintf("%0*d", sortKeyLength, math.MaxInt64-t.UnixNano())
+}
+
+func putIndexEntry(ctx contractapi.TransactionContextInterface, indexType string, ownerId string, t time.Time, itemId string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(indexType, []string{ownerId, indexSortKey(t), itemId})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
+
+/*
+Walks one owner's index from the bookmark, one bookmarked page at a time, until limit entries have been accepted or the index ends.
+Entries before the from position (empty for none) are skipped.
+*/
+func scanIndex(ctx contractapi.TransactionContextInterface, indexType string, ownerId string, bookmark string, from string, limit int, accept func(itemId string) (bool, error)) ([]indexEntry, error) {
+	entries := make([]indexEntry, 0, limit)
+	for len(entries) < limit {
+		pageSize := limit - len(entries)
+		page, nextBookmark, fetched, err := scanIndexPage(ctx, indexType, ownerId, bookmark, from, pageSize, accept)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+		if nextBookmark == "" || fetched < pageSize {
+			break
+		}
+		bookmark = nextBookmark
+	}
+	return entries, nil
+}
+
+func scanIndexPage(ctx contractapi.TransactionContextInterface, indexType string, ownerId string, bookmark string, from string, pageSize int, accept func(itemId string) (bool, error)) ([]indexEntry, string, int, error) {
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(indexType, []string{ownerId}, int32(pageSize), bookmark)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer resultsIterator.Close()
+
+	entries := make([]indexEntry, 0, pageSize)
+	fetched := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", 0, err
+		}
+		fetched++
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if len(attributes) != 3 {
+			continue
+		}
+		entry := indexEntry{sortKey: attributes[1], itemId: attributes[2], bookmark: bookmark}
+		if entry.position() < from {
+			continue
+		}
+		accepted, err := accept(entry.itemId)
+		if err == errEndOfScan {
+			return entries, "", fetched, nil
+		}
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if accepted {
+			entries = append(entries, entry)
+		}
+	}
+	if metadata == nil {
+		return entries, "", fetched, nil
+	}
+	return entries, metadata.Bookmark, fetched, nil
+}
+
+/*
+Returns, newest first, up to limit accepted entries across the indexes of several owners, starting at the cursor.
+Each owner's scan resumes from its bookmark in the cursor, and the results are merged by sort key.
+When limit entries are returned, the last one carries the bookmarks to resume every owner's scan at it, see indexCursor.
+*/
+func scanIndexes(ctx contractapi.TransactionContextInterface, indexType string, ownerIds []string, cursor string, limit int, accept func(itemId string) (bool, error)) ([]indexEntry, error) {
+	var start indexEntry
+	if cursor != "" {
+		var err error
+		start, err = parseCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	merged := make([]indexEntry, 0)
+	ownerEntries := make(map[string][]indexEntry)
+	var done []string
+	for _, ownerId := range ownerIds {
+		if _, scanned := ownerEntries[ownerId]; scanned || contains(done, ownerId) {
+			continue
+		}
+		bookmark, from := "", ""
+		if cursor != "" {
+			from = start.position()
+			if start.resume != nil {
+				if contains(start.resume.Done, ownerId) {
+					done = append(done, ownerId)
+					continue
+				}
+				bookmark = start.resume.Bookmarks[ownerId] //owners that weren't part of the scan start from the newest entry
+			}
+		}
+		entries, err := scanIndex(ctx, indexType, ownerId, bookmark, from, limit, accept)
+		if err != nil {
+			return nil, err
+		}
+		ownerEntries[ownerId] = entries
+		merged = append(merged, entries...)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].sortKey != merged[j].sortKey {
+			return merged[i].sortKey < merged[j].sortKey
+		}
+		return merged[i].itemId < merged[j].itemId
+	})
+	if len(merged) < limit {
+		return merged, nil
+	}
+	merged = merged[:limit]
+	last := &merged[limit-1]
+	last.resume = &indexCursor{SortKey: last.sortKey, ItemId: last.itemId, Bookmarks: make(map[string]string), Done: done}
+	for ownerId, entries := range ownerEntries {
+		resumed := false
+		for _, entry := range entries {
+			if entry.position() >= last.position() {
+				last.resume.Bookmarks[ownerId] = entry.bookmark
+				resumed = true
+				break
+			}
+		}
+		if !resumed {
+			last.resume.Done = append(last.resume.Done, ownerId)
+		}
+	}
+	sort.Strings(last.resume.Done)
+	return merged, nil
+}
+
+/*
+Returns, newest first, up to limit accepted entries of an index kept in a private data collection, starting at the cursor.
+Entries are stored under (index type, owner key..., sort key, item Id). Private data can't be read with bookmarks,
+so the owner's index is walked from the start up to the cursor. accept also receives the entry's stored value.
+*/
+func scanPrivateIndex(ctx contractapi.TransactionContextInterface, collection string, indexType string, ownerKey []string, cursor string, limit int, accept func(entry indexEntry, value []byte) (bool, error)) ([]indexEntry, error) {
+	var start indexEntry
+	if cursor != "" {
+		var err error
+		start, err = parseCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, indexType, ownerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private data: %w", err)
+	}
+	defer resultsIterator.Close()
+
+	entries := make([]indexEntry, 0, limit)
+	for resultsIterator.HasNext() && len(entries) < limit {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(attributes) != len(ownerKey)+2 {
+			continue
+		}
+		entry := indexEntry{sortKey: attributes[len(ownerKey)], itemId: attributes[len(ownerKey)+1]}
+		if cursor != "" && entry.position() < start.position() {
+			continue
+		}
+		accepted, err := accept(entry, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		if accepted {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+/*
+Splits the entries fetched for a page, which include one extra entry, into the page itself and the cursor of the next page.
+*/
+func nextPage(entries []indexEntry, pageSize int) ([]indexEntry, string) {
+	if len(entries) > pageSize {
+		return entries[:pageSize], entries[pageSize].cursor()
+	}
+	return entries, ""
+}
+
+/*
+Returns an accept function for scanIndexes that keeps posts which aren't hidden, caching them in posts.
+A cross-post is also dropped once its original is hidden or deleted.
+*/
+func (s *SmartContract) visiblePosts(ctx contractapi.TransactionContextInterface, posts map[string]*Post) func(string) (bool, error) {
+	return func(postId string) (bool, error) {
+		post, err := s.GetPost(ctx, postId)
+		if err != nil {
+			return false, err
+		}
+		if post == nil || post.Hidden {
+			return false, nil
+		}
+		if post.CrossPostOf != "" {
+			sharedPost, err := s.GetPost(ctx, post.CrossPostOf)
+			if err != nil {
+				return false, err
+			}
+			if sharedPost == nil || sharedPost.Hidden {
+				return false, nil
+			}
+		}
+		posts[postId] = post
+		return true, nil
+	}
+}
+
+/*
+Returns the accept function for a feed of posts from the given community or author indexes:
+visible posts with the flair, if given, and without cross-posts of posts the feed already shows.
+*/
+func (s *SmartContract) feedPosts(ctx contractapi.TransactionContextInterface, indexType string, ownerIds []string, userId string, flair string, posts map[string]*Post) func(string) (bool, error) {
+	accept := s.readablePosts(ctx, userId, posts, s.flairFilter(ctx, flair, posts, s.visiblePosts(ctx, posts)))
+	if indexType == authorPostIndex {
+		return s.dedupeFollowedCrossPosts(ctx, ownerIds, posts, accept)
+	}
+	if len(ownerIds) < 2 {
+		return accept
+	}
+	return s.dedupeCrossPosts(ctx, ownerIds, posts, accept)
+}
+
+/*
+Returns an accept function for scanIndexes that keeps comments which aren't hidden, caching them in comments.
+*/
+func (s *SmartContract) visibleComments(ctx contractapi.TransactionContextInterface, comments map[string]*Comment) func(string) (bool, error) {
+	return func(commentId string) (bool, error) {
+		comment, err := s.GetComment(ctx, commentId)
+		if err != nil {
+			return false, err
+		}
+		if comment == nil || comment.Hidden {
+			return false, nil
+		}
+		comments[commentId] = comment
+		return true, nil
+	}
+}
+
+/*
+Builds a page of posts from the fetched index entries, as seen by the given user.
+*/
+func (s *SmartContract) postPage(ctx contractapi.TransactionContextInterface, entries []indexEntry, posts map[string]*Post, userId string) (*PostPage, error) {
+	entries, nextCursor := nextPage(entries, PostsPerPage)
+	page := PostPage{
+		Posts:      make([]*PostModified, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		modifiedPost, err := s.convertToPostModified(ctx, posts[entry.itemId], userId)
+		if err != nil {
+			return nil, err
+		}
+		page.Posts = append(page.Posts, modifiedPost)
+	}
+	return &page, nil
+}
+
+/*
+Builds a page of comments from the fetched index entries, as seen by the given user. comments is keyed by the entries' item Ids.
+*/
+func (s *SmartContract) commentPage(ctx contractapi.TransactionContextInterface, entries []indexEntry, comments map[string]*Comment, userId string) (*CommentPage, error) {
+	entries, nextCursor := nextPage(entries, CommentsPerPage)
+	page := CommentPage{
+		Comments:   make([]*CommentModified, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		modifiedComment, err := s.convertToCommentModified(ctx, comments[entry.itemId], userId)
+		if err != nil {
+			return nil, err
+		}
+		page.Comments = append(page.Comments, modifiedComment)
+	}
+	return &page, nil
+}
+
+/*
+Returns an accept function for scanIndexes that keeps posts and comments which aren't hidden, caching them in posts and comments.
+*/
+func (s *SmartContract) visibleItems(ctx contractapi.TransactionContextInterface, posts map[string]*Post, comments map[string]*Comment) func(string) (bool, error) {
+	visiblePost := s.visiblePosts(ctx, posts)
+	visibleComment := s.visibleComments(ctx, comments)
+	return func(itemId string) (bool, error) {
+		itemType, err := s.getItemType(ctx, itemId)
+		if err != nil {
+			return false, err
+		}
+		if itemType == commentObjectType {
+			return visibleComment(itemId)
+		}
+		return visiblePost(itemId)
+	}
+}
+
+/*
+Builds a page of mixed posts and comments from the fetched index entries, as seen by the given user.
+*/
+func (s *SmartContract) postOrCommentPage(ctx contractapi.TransactionContextInterface, entries []indexEntry, posts map[string]*Post, comments map[string]*Comment, userId string) (*PostOrCommentPage, error) {
+	entries, nextCursor := nextPage(entries, PostsPerPage)
+	page := PostOrCommentPage{
+		Items:      make([]*PostOrComment, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		if comment, ok := comments[entry.itemId]; ok {
+			modifiedComment, err := s.convertToCommentModified(ctx, comment, userId)
+			if err != nil {
+				return nil, err
+			}
+			page.Items = append(page.Items, &PostOrComment{Comment: modifiedComment})
+		} else {
+			modifiedPost, err := s.convertToPostModified(ctx, posts[entry.itemId], userId)
+			if err != nil {
+				return nil, err
+			}
+			page.Items = append(page.Items, &PostOrComment{Post: modifiedPost})
+		}
+	}
+	return &page, nil
+}
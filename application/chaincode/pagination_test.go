@@ -0,0 +1,97 @@
+package chaincode
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndexSortKey(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		older, newer time.Time
+	}{
+		{"a second apart", base, base.Add(time.Second)},
+		{"a nanosecond apart", base, base.Add(time.Nanosecond)},
+		{"years apart", base, base.AddDate(30, 0, 0)},
+		{"from the epoch", time.Unix(0, 0), base},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			older, newer := indexSortKey(test.older), indexSortKey(test.newer)
+			if len(older) != sortKeyLength || len(newer) != sortKeyLength {
+				t.Fatalf("sort keys %q and %q aren't %d digits long", older, newer, sortKeyLength)
+			}
+			if newer >= older {
+				t.Errorf("sort key %q of the newer time doesn't sort before %q", newer, older)
+			}
+		})
+	}
+	if indexSortKey(base) != indexSortKey(base.In(time.FixedZone("east", 3600))) {
+		t.Errorf("sort keys of the same instant differ by time zone")
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	sortKey := indexSortKey(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	resume := &indexCursor{SortKey: sortKey, ItemId: "p_1", Bookmarks: map[string]string{"c_1": "bookmark"}, Done: []string{"c_2"}}
+	tests := []struct {
+		name    string
+		cursor  string
+		want    indexEntry
+		wantErr bool
+	}{
+		{"position", sortKey + "_p_1", indexEntry{sortKey: sortKey, itemId: "p_1"}, false},
+		{"position with an underscore in the item Id", sortKey + "_p_1_2", indexEntry{sortKey: sortKey, itemId: "p_1_2"}, false},
+		{"resume cursor", indexEntry{sortKey: sortKey, itemId: "p_1", resume: resume}.cursor(), indexEntry{sortKey: sortKey, itemId: "p_1", resume: resume}, false},
+		{"empty", "", indexEntry{}, true},
+		{"short sort key", "123_p_1", indexEntry{}, true},
+		{"not base64", "not a cursor!", indexEntry{}, true},
+		{"base64 without a sort key", "e30", indexEntry{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseCursor(test.cursor)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseCursor(%q) error = %v, want error %v", test.cursor, err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseCursor(%q) = %+v, want %+v", test.cursor, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	entries := make([]indexEntry, 4)
+	for i := range entries {
+		entries[i] = indexEntry{sortKey: indexSortKey(time.Unix(int64(100-i), 0)), itemId: string(rune('a' + i))}
+	}
+	resumed := append([]indexEntry(nil), entries...)
+	resumed[3].resume = &indexCursor{SortKey: entries[3].sortKey, ItemId: entries[3].itemId, Bookmarks: map[string]string{}}
+	tests := []struct {
+		name       string
+		entries    []indexEntry
+		pageSize   int
+		wantPage   []indexEntry
+		wantCursor string
+	}{
+		{"empty", nil, 3, nil, ""},
+		{"fewer entries than the page size", entries[:2], 3, entries[:2], ""},
+		{"exactly the page size", entries[:3], 3, entries[:3], ""},
+		{"one extra entry", entries, 3, entries[:3], entries[3].position()},
+		{"extra entry with a resume cursor", resumed, 3, resumed[:3], resumed[3].cursor()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, cursor := nextPage(test.entries, test.pageSize)
+			if !reflect.DeepEqual(page, test.wantPage) {
+				t.Errorf("page = %+v, want %+v", page, test.wantPage)
+			}
+			if cursor != test.wantCursor {
+				t.Errorf("cursor = %q, want %q", cursor, test.wantCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Post types
+const (
+	PostTypeText = "text"
+	PostTypePoll = "poll"
+)
+
+// Bounds on the options of a poll
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 10
+	MaxPollOptionLength = 100
+)
+
+// Object type for the poll votes, keyed by poll and voter
+const pollVoteObjectType = "pollVote"
+
+type PollOption struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+/*
+The options of a poll post and when it closes. A zero ClosesAt keeps the poll open.
+*/
+type Poll struct {
+	Options  []PollOption `json:"options"`
+	ClosesAt time.Time    `json:"closesAt"`
+}
+
+type PollVote struct {
+	Poll   string `json:"poll"`
+	Voter  string `json:"voter"`
+	Option string `json:"option"`
+}
+
+type PollOptionResult struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+/*
+The tally of a poll, as seen by the given user.
+*/
+type PollResults struct {
+	PostId     string             `json:"postId"`
+	Options    []PollOptionResult `json:"options"`
+	TotalVotes int                `json:"totalVotes"`
+	ClosesAt   time.Time          `json:"closesAt"`
+	Closed     bool               `json:"closed"`
+	UserVote   string             `json:"userVote"` //Id of the option the user voted for, empty if they haven't voted
+}
+
+type PollVoteEventPayload struct {
+	PostId      string `json:"postId"`
+	CommunityId string `json:"communityId"`
+	Voter       string `json:"voter"`
+	Option      string `json:"option"`
+}
+
+func postType(post *Post) string {
+	if post.Type == "" {
+		return PostTypeText
+	}
+	return post.Type
+}
+
+/*
+Parses and validates the options of a new poll, given as a JSON array of option texts.
+Options get Ids "1", "2", ... in the order given.
+*/
+func parsePollOptions(optionsJson string) ([]PollOption, error) {
+	var texts []string
+	err := json.Unmarshal([]byte(optionsJson), &texts)
+	if err != nil {
+		return nil, fmt.Errorf("Poll options must be a JSON array of strings: %w", err)
+	}
+	if len(texts) < MinPollOptions || len(texts) > MaxPollOptions {
+		return nil, fmt.Errorf("A poll must have between %d and %d options", MinPollOptions, MaxPollOptions)
+	}
+	options := make([]PollOption, 0, len(texts))
+	for i, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, fmt.Errorf("Poll option %d is empty", i+1)
+		}
+		if len(text) > MaxPollOptionLength {
+			return nil, fmt.Errorf("Poll option %d is longer than %d characters", i+1, MaxPollOptionLength)
+		}
+		for _, option := range options {
+			if strings.EqualFold(option.Text, text) {
+				return nil, fmt.Errorf("Poll option %s is repeated", text)
+			}
+		}
+		options = append(options, PollOption{ID: strconv.Itoa(i + 1), Text: text})
+	}
+	return options, nil
+}
+
+/*
+Creates a poll post within a community. It takes the same parameters as CreatePost, plus the options,
+as a JSON array of option texts, and an optional close time in RFC 3339 format (empty for a poll that never closes).
+*/
+func (s *SmartContract) CreatePoll(ctx contractapi.TransactionContextInterface, communityId string, title string, content string, author string, flairId string, optionsJson string, closesAt string) (*Post, error) {
+	options, err := parsePollOptions(optionsJson)
+	if err != nil {
+		return nil, err
+	}
+	poll := Poll{Options: options}
+	if closesAt != "" {
+		poll.ClosesAt, err = time.Parse(time.RFC3339, closesAt)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid poll close time %s", closesAt)
+		}
+		currentTime, err := txTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !poll.ClosesAt.After(currentTime) {
+			return nil, fmt.Errorf("Poll close time %s has already passed", closesAt)
+		}
+		poll.ClosesAt = poll.ClosesAt.UTC()
+	}
+	return s.createPost(ctx, communityId, title, content, author, flairId, &poll)
+}
+
+func pollClosed(ctx contractapi.TransactionContextInterface, poll *Poll) (bool, error) {
+	if poll.ClosesAt.IsZero() {
+		return false, nil
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	return !currentTime.Before(poll.ClosesAt), nil
+}
+
+/*
+Loads a poll post, or the original of a cross-posted poll, failing if the post doesn't exist or isn't a poll.
+*/
+func (s *SmartContract) getPoll(ctx contractapi.TransactionContextInterface, postId string) (*Post, error) {
+	postId, err := s.resolvePostId(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	existingPost, err := s.GetPost(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	if existingPost == nil {
+		return nil, fmt.Errorf("Post with ID %s doesn't exists", postId)
+	}
+	if existingPost.Poll == nil {
+		return nil, fmt.Errorf("Post with ID %s is not a poll", postId)
+	}
+	return existingPost, nil
+}
+
+/*
+Records a member's vote on a poll. Only members of the poll's community can vote, each of them once,
+and votes are refused once the poll has closed or the post is hidden.
+*/
+func (s *SmartContract) CastPollVote(ctx contractapi.TransactionContextInterface, postId string, optionId string, userId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	existingPost, err := s.getPoll(ctx, postId)
+	if err != nil {
+		return err
+	}
+	postId = existingPost.ID
+	if existingPost.Hidden {
+		return fmt.Errorf("Post with ID %s is hidden", postId)
+	}
+	closed, err := pollClosed(ctx, existingPost.Poll)
+	if err != nil {
+		return err
+	}
+	if closed {
+		return fmt.Errorf("Poll %s is closed", postId)
+	}
+	validOption := false
+	for _, option := range existingPost.Poll.Options {
+		if option.ID == optionId {
+			validOption = true
+		}
+	}
+	if !validOption {
+		return fmt.Errorf("Poll %s has no option %s", postId, optionId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, existingPost.Community)
+	if err != nil {
+		return err
+	}
+	if !contains(existingCommunity.Users, userId) {
+		return fmt.Errorf("User cannot vote as you are not a member of community %s", existingPost.Community)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(pollVoteObjectType, []string{postId, userId})
+	if err != nil {
+		return err
+	}
+	existingVote, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read poll vote from ledger: %w", err)
+	}
+	if existingVote != nil {
+		return fmt.Errorf("User with ID %s has already voted in poll %s", userId, postId)
+	}
+	vote := PollVote{
+		Poll:   postId,
+		Voter:  userId,
+		Option: optionId,
+	}
+	voteJson, _ := json.Marshal(vote)
+	err = ctx.GetStub().PutState(key, voteJson)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, PollVoteCastEvent, PollVoteEventPayload{PostId: postId, CommunityId: existingPost.Community, Voter: userId, Option: optionId})
+}
+
+/*
+Counts the votes recorded against each option of a poll post.
+*/
+func (s *SmartContract) tallyPoll(ctx contractapi.TransactionContextInterface, post *Post, userId string) (*PollResults, error) {
+	closed, err := pollClosed(ctx, post.Poll)
+	if err != nil {
+		return nil, err
+	}
+	results := PollResults{
+		PostId:   post.ID,
+		Options:  make([]PollOptionResult, 0, len(post.Poll.Options)),
+		ClosesAt: post.Poll.ClosesAt,
+		Closed:   closed,
+	}
+	counts := make(map[string]int)
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pollVoteObjectType, []string{post.ID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var vote PollVote
+		err = json.Unmarshal(queryResponse.Value, &vote)
+		if err != nil {
+			return nil, err
+		}
+		counts[vote.Option]++
+		results.TotalVotes++
+		if vote.Voter == userId {
+			results.UserVote = vote.Option
+		}
+	}
+	for _, option := range post.Poll.Options {
+		results.Options = append(results.Options, PollOptionResult{ID: option.ID, Text: option.Text, Votes: counts[option.ID]})
+	}
+	return &results, nil
+}
+
+/*
+Returns the current tally of a poll, including the option the given user voted for.
+*/
+func (s *SmartContract) GetPollResults(ctx contractapi.TransactionContextInterface, postId string, userId string) (*PollResults, error) {
+	existingPost, err := s.getPoll(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity, err := s.GetCommunity(ctx, existingPost.Community)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	return s.tallyPoll(ctx, existingPost, userId)
+}
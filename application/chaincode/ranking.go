@@ -0,0 +1,274 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Orders in which GetUserFeed and GetCommunityPosts can return posts
+const (
+	SortNew           = "new"
+	SortHot           = "hot"
+	SortTop           = "top"
+	SortControversial = "controversial"
+)
+
+// Time windows for the top and controversial orders. A zero duration covers every post.
+var rankingWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+// Most posts considered when ranking a feed, in total across its communities or followed users,
+// so a ranked page reads a bounded number of posts however many owners the feed covers
+const RankedPostsLimit = 1000
+
+// Seconds of recency worth a tenfold score in the hot order
+const hotDecaySeconds = 45000
+
+// Fraction bits of log10Fixed
+const log10FractionBits = 10
+
+type rankedPost struct {
+	entry indexEntry
+	rank  int64
+}
+
+/*
+Returns the base 10 logarithm of n (n >= 1) as a fixed point number with log10FractionBits fraction bits.
+Ranks are computed with integers only, so every endorsing peer orders posts identically whatever its floating point behaviour.
+*/
+func log10Fixed(n int64) int64 {
+	const scale = int64(100000000)
+	if n > 1000000000 {
+		n = 1000000000
+	}
+	var result int64
+	power := int64(1)
+	for power*10 <= n {
+		power *= 10
+		result++
+	}
+	mantissa := n * scale / power // in [scale, 10*scale)
+	for i := 0; i < log10FractionBits; i++ {
+		mantissa = mantissa * mantissa / scale
+		result <<= 1
+		if mantissa >= 10*scale {
+			mantissa /= 10
+			result |= 1
+		}
+	}
+	return result
+}
+
+/*
+Counts the upvotes and downvotes recorded against a post or comment.
+*/
+func (s *SmartContract) countVotes(ctx contractapi.TransactionContextInterface, itemId string) (int64, int64, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(voteObjectType, []string{itemId})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resultsIterator.Close()
+
+	var up, down int64
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, 0, err
+		}
+		var vote Vote
+		err = json.Unmarshal(queryResponse.Value, &vote)
+		if err != nil {
+			return 0, 0, err
+		}
+		if vote.Direction > 0 {
+			up++
+		} else if vote.Direction < 0 {
+			down++
+		}
+	}
+	return up, down, nil
+}
+
+/*
+Computes the rank of a post in the given order; higher ranks come first.
+hot: the order of magnitude of the score plus the post's creation time, so a tenfold score is worth hotDecaySeconds of recency.
+top: the score.
+controversial: the total number of votes weighted by how evenly they split between up and down.
+*/
+func (s *SmartContract) rankPost(ctx contractapi.TransactionContextInterface, post *Post, sortBy string) (int64, error) {
+	// A cross-post is ranked by the votes of its original and by when it was shared
+	createdAt := post.CreatedAt
+	if post.CrossPostOf != "" {
+		sharedPost, err := s.GetPost(ctx, post.CrossPostOf)
+		if err != nil {
+			return 0, err
+		}
+		post = sharedPost
+	}
+	if sortBy == SortControversial {
+		up, down, err := s.countVotes(ctx, post.ID)
+		if err != nil {
+			return 0, err
+		}
+		if up == 0 || down == 0 {
+			return 0, nil
+		}
+		return (up + down) * (min64(up, down) << log10FractionBits) / max64(up, down), nil
+	}
+	score, err := s.getScore(ctx, post.ID, post.Score)
+	if err != nil {
+		return 0, err
+	}
+	if sortBy == SortTop {
+		return int64(score), nil
+	}
+	return hotRank(score, createdAt), nil
+}
+
+/*
+Returns the hot rank of a post with the given score, created or shared at createdAt.
+*/
+func hotRank(score int, createdAt time.Time) int64 {
+	magnitude := int64(score)
+	sign := int64(1)
+	if magnitude < 0 {
+		magnitude = -magnitude
+		sign = -1
+	} else if magnitude == 0 {
+		sign = 0
+	}
+	if magnitude < 1 {
+		magnitude = 1
+	}
+	return sign*log10Fixed(magnitude)*hotDecaySeconds>>log10FractionBits + createdAt.Unix()
+}
+
+/*
+Returns the most recent accepted entries of each owner's index, at most RankedPostsLimit in total. The limit is shared
+evenly among the owners, and what an owner doesn't use goes to the owners scanned after it. Once the limit is used up,
+the remaining owners aren't scanned.
+*/
+func scanRankedEntries(ctx contractapi.TransactionContextInterface, indexType string, ownerIds []string, accept func(itemId string) (bool, error)) ([]indexEntry, error) {
+	owners := make([]string, 0, len(ownerIds))
+	for _, ownerId := range ownerIds {
+		if !contains(owners, ownerId) {
+			owners = append(owners, ownerId)
+		}
+	}
+	entries := make([]indexEntry, 0)
+	for i, ownerId := range owners {
+		remaining := RankedPostsLimit - len(entries)
+		if remaining == 0 {
+			break
+		}
+		share := max(remaining/(len(owners)-i), 1)
+		ownerEntries, err := scanIndex(ctx, indexType, ownerId, "", "", share, accept)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ownerEntries...)
+	}
+	return entries, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+/*
+Returns a page of the visible posts in the given indexes, ordered by hot, top or controversial rank.
+The most recent posts of each owner (within the window, for top and controversial, and with the flair, if given) are ranked,
+RankedPostsLimit in all, see scanRankedEntries; ties go to the newer post.
+The cursor of a ranked page is the offset of the next page in the ranking.
+*/
+func (s *SmartContract) rankedPostPage(ctx contractapi.TransactionContextInterface, indexType string, ownerIds []string, userId string, cursor string, sortBy string, window string, flair string) (*PostPage, error) {
+	if sortBy != SortHot && sortBy != SortTop && sortBy != SortControversial {
+		return nil, fmt.Errorf("Invalid sort %s", sortBy)
+	}
+	if window == "" || sortBy == SortHot {
+		window = "all"
+	}
+	windowLength, ok := rankingWindows[window]
+	if !ok {
+		return nil, fmt.Errorf("Invalid time window %s", window)
+	}
+	offset := 0
+	if cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("Invalid cursor %s", cursor)
+		}
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	posts := make(map[string]*Post)
+	visiblePost := s.feedPosts(ctx, indexType, ownerIds, userId, flair, posts)
+	entries, err := scanRankedEntries(ctx, indexType, ownerIds, func(postId string) (bool, error) {
+		accepted, err := visiblePost(postId)
+		if err != nil || !accepted {
+			return false, err
+		}
+		if windowLength > 0 && posts[postId].CreatedAt.Before(currentTime.Add(-windowLength)) {
+			return false, errEndOfScan
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := make([]rankedPost, 0, len(entries))
+	for _, entry := range entries {
+		rank, err := s.rankPost(ctx, posts[entry.itemId], sortBy)
+		if err != nil {
+			return nil, err
+		}
+		ranked = append(ranked, rankedPost{entry: entry, rank: rank})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].rank != ranked[j].rank {
+			return ranked[i].rank > ranked[j].rank
+		}
+		if ranked[i].entry.sortKey != ranked[j].entry.sortKey {
+			return ranked[i].entry.sortKey < ranked[j].entry.sortKey
+		}
+		return ranked[i].entry.itemId < ranked[j].entry.itemId
+	})
+
+	start := min(offset, len(ranked))
+	end := min(offset+PostsPerPage, len(ranked))
+	page := PostPage{Posts: make([]*PostModified, 0, end-start)}
+	if end < len(ranked) {
+		page.NextCursor = strconv.Itoa(end)
+	}
+	for _, rankedEntry := range ranked[start:end] {
+		modifiedPost, err := s.convertToPostModified(ctx, posts[rankedEntry.entry.itemId], userId)
+		if err != nil {
+			return nil, err
+		}
+		page.Posts = append(page.Posts, modifiedPost)
+	}
+	return &page, nil
+}
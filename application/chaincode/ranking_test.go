@@ -0,0 +1,109 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLog10Fixed(t *testing.T) {
+	one := int64(1) << log10FractionBits
+	tests := []struct {
+		name string
+		n    int64
+		want int64
+	}{
+		{"one", 1, 0},
+		{"ten", 10, one},
+		{"hundred", 100, 2 * one},
+		{"million", 1000000, 6 * one},
+		{"capped", 1000000000000, 9 * one},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := log10Fixed(test.n); got != test.want {
+				t.Errorf("log10Fixed(%d) = %d, want %d", test.n, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLog10FixedApproximatesLog10(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want int64 // round(log10(n) * 1024)
+	}{
+		{2, 308},
+		{5, 716},
+		{99, 2044},
+		{12345, 4190},
+	}
+	for _, test := range tests {
+		got := log10Fixed(test.n)
+		if got < test.want-1 || got > test.want+1 {
+			t.Errorf("log10Fixed(%d) = %d, want %d within 1", test.n, got, test.want)
+		}
+	}
+}
+
+func TestLog10FixedIncreases(t *testing.T) {
+	previous := log10Fixed(1)
+	for n := int64(2); n <= 10000; n++ {
+		current := log10Fixed(n)
+		if current < previous {
+			t.Fatalf("log10Fixed(%d) = %d is less than log10Fixed(%d) = %d", n, current, n-1, previous)
+		}
+		previous = current
+	}
+}
+
+func TestHotRank(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		score int
+		age   time.Duration
+		want  int64
+	}{
+		{"zero score", 0, 0, createdAt.Unix()},
+		{"score of one", 1, 0, createdAt.Unix()},
+		{"tenfold score", 10, 0, createdAt.Unix() + hotDecaySeconds},
+		{"negative score", -10, 0, createdAt.Unix() - hotDecaySeconds},
+		{"newer post", 0, time.Hour, createdAt.Unix() + 3600},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := hotRank(test.score, createdAt.Add(test.age)); got != test.want {
+				t.Errorf("hotRank(%d) = %d, want %d", test.score, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHotRankOrder(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		higherScore   int
+		higherAge     time.Duration
+		lowerScore    int
+		lowerAge      time.Duration
+		wantEqualRank bool
+	}{
+		{"higher score", 100, 0, 10, 0, false},
+		{"newer post with equal score", 10, time.Second, 10, 0, false},
+		{"tenfold score against its recency", 100, 0, 10, hotDecaySeconds * time.Second, true},
+		{"scores of one and minus one", 1, 0, -1, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			higher := hotRank(test.higherScore, createdAt.Add(test.higherAge))
+			lower := hotRank(test.lowerScore, createdAt.Add(test.lowerAge))
+			if test.wantEqualRank && higher != lower {
+				t.Errorf("ranks %d and %d differ, want a tie", higher, lower)
+			}
+			if !test.wantEqualRank && higher <= lower {
+				t.Errorf("rank %d isn't above %d", higher, lower)
+			}
+		})
+	}
+}
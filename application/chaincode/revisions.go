@@ -0,0 +1,257 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+A version of a post or comment. Every edit stores the version it replaces as a revision.
+Revisions are written once, under their own key, and never rewritten.
+*/
+type Revision struct {
+	ItemId    string    `json:"itemId"`
+	Number    int       `json:"number"`                               //0 for the original version
+	Title     string    `json:"title,omitempty" metadata:",optional"` //posts only
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"` //when this version was written
+	TxID      string    `json:"txId"`      //transaction that replaced this version
+}
+
+func revisionKey(ctx contractapi.TransactionContextInterface, itemId string, number int) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(revisionObjectType, []string{itemId, fmt.Sprintf("%06d", number)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create revision key for ID %s: %w", itemId, err)
+	}
+	return key, nil
+}
+
+func putRevision(ctx contractapi.TransactionContextInterface, revision Revision) error {
+	key, err := revisionKey(ctx, revision.ItemId, revision.Number)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read revision from ledger: %w", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("Revision %d of %s already exists", revision.Number, revision.ItemId)
+	}
+	revisionJson, _ := json.Marshal(revision)
+	return ctx.GetStub().PutState(key, revisionJson)
+}
+
+/*
+Allows the author of a post to change its title and content, which must meet the community's posting requirements like a new post.
+The version being replaced is kept in the post's revision history, and the post is marked as edited.
+*/
+func (s *SmartContract) EditPost(ctx contractapi.TransactionContextInterface, postId string, title string, content string, userId string) (*Post, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	existingPost, err := s.GetPost(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	if existingPost == nil {
+		return nil, fmt.Errorf("Post with ID %s doesn't exists", postId)
+	}
+	if existingPost.Author != userId {
+		return nil, fmt.Errorf("User with ID %s is not the author of post %s", userId, postId)
+	}
+	if existingPost.CrossPostOf != "" {
+		return nil, fmt.Errorf("Post with ID %s is a cross-post, edit the original post %s instead", postId, existingPost.CrossPostOf)
+	}
+	if existingPost.Hidden {
+		return nil, fmt.Errorf("Post with ID %s is hidden and cannot be edited", postId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, existingPost.Community)
+	if err != nil {
+		return nil, err
+	}
+	existingUser, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", userId)
+	}
+	err = s.checkPostRequirements(ctx, existingCommunity, existingUser, postType(existingPost), title, content)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revision := Revision{
+		ItemId:    postId,
+		Number:    existingPost.Revisions,
+		Title:     existingPost.Title,
+		Content:   existingPost.Content,
+		CreatedAt: versionTime(existingPost.CreatedAt, existingPost.EditedAt, existingPost.Revisions),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	err = putRevision(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	existingPost.Title = title
+	existingPost.Content = content
+	existingPost.Revisions++
+	existingPost.EditedAt = currentTime
+	postJson, _ := json.Marshal(existingPost)
+	err = putState(ctx, postObjectType, postId, postJson)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, ContentEditedEvent, ContentEventPayload{ItemId: postId, ItemType: postObjectType, CommunityId: existingPost.Community, UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	return existingPost, nil
+}
+
+/*
+Allows the author of a comment to change its content, which must meet the community's comment requirements like a new comment.
+The version being replaced is kept in the comment's revision history, and the comment is marked as edited.
+*/
+func (s *SmartContract) EditComment(ctx contractapi.TransactionContextInterface, commentId string, content string, userId string) (*Comment, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	existingComment, err := s.GetComment(ctx, commentId)
+	if err != nil {
+		return nil, err
+	}
+	if existingComment == nil {
+		return nil, fmt.Errorf("Comment with ID %s doesn't exists", commentId)
+	}
+	if existingComment.Author != userId {
+		return nil, fmt.Errorf("User with ID %s is not the author of comment %s", userId, commentId)
+	}
+	if existingComment.Hidden {
+		return nil, fmt.Errorf("Comment with ID %s is hidden and cannot be edited", commentId)
+	}
+	existingCommunity, err := s.GetCommunity(ctx, existingComment.Community)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommentRequirements(existingCommunity, content)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revision := Revision{
+		ItemId:    commentId,
+		Number:    existingComment.Revisions,
+		Content:   existingComment.Content,
+		CreatedAt: versionTime(existingComment.CreatedAt, existingComment.EditedAt, existingComment.Revisions),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	err = putRevision(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	existingComment.Content = content
+	existingComment.Revisions++
+	existingComment.EditedAt = currentTime
+	commentJson, _ := json.Marshal(existingComment)
+	err = putState(ctx, commentObjectType, commentId, commentJson)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, ContentEditedEvent, ContentEventPayload{ItemId: commentId, ItemType: commentObjectType, CommunityId: existingComment.Community, UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	return existingComment, nil
+}
+
+/*
+Returns when the current version of an item was written: its creation time until it is first edited, its last edit time afterwards.
+*/
+func versionTime(createdAt time.Time, editedAt time.Time, revisions int) time.Time {
+	if revisions == 0 {
+		return createdAt
+	}
+	return editedAt
+}
+
+/*
+Returns every version of a post or comment, oldest first, ending with the current one.
+The current version carries no transaction Id since nothing has replaced it yet.
+It takes item Id and user Id as parameters. The user must be able to read the item's community,
+and only its moderators can read the versions of a hidden item.
+*/
+func (s *SmartContract) GetRevisionHistory(ctx contractapi.TransactionContextInterface, itemId string, userId string) ([]*Revision, error) {
+	itemType, err := s.getItemType(ctx, itemId)
+	if err != nil {
+		return nil, err
+	}
+	current := Revision{ItemId: itemId}
+	var communityId string
+	var hidden bool
+	if itemType == postObjectType {
+		existingPost, err := s.GetPost(ctx, itemId)
+		if err != nil {
+			return nil, err
+		}
+		current.Number = existingPost.Revisions
+		current.Title = existingPost.Title
+		current.Content = existingPost.Content
+		current.CreatedAt = versionTime(existingPost.CreatedAt, existingPost.EditedAt, existingPost.Revisions)
+		communityId, hidden = existingPost.Community, existingPost.Hidden
+	} else {
+		existingComment, err := s.GetComment(ctx, itemId)
+		if err != nil {
+			return nil, err
+		}
+		current.Number = existingComment.Revisions
+		current.Content = existingComment.Content
+		current.CreatedAt = versionTime(existingComment.CreatedAt, existingComment.EditedAt, existingComment.Revisions)
+		communityId, hidden = existingComment.Community, existingComment.Hidden
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	if hidden && (!contains(existingCommunity.Moderators, userId) || authorizeCaller(ctx, userId) != nil) {
+		return nil, fmt.Errorf("Item with ID %s is hidden", itemId)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(revisionObjectType, []string{itemId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	revisions := make([]*Revision, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var revision Revision
+		err = json.Unmarshal(queryResponse.Value, &revision)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	revisions = append(revisions, &current)
+	return revisions, nil
+}
@@ -0,0 +1,298 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Bounds on the rule list a community can define
+const (
+	MaxCommunityRules        = 15
+	MaxRuleTitleLength       = 100
+	MaxRuleDescriptionLength = 500
+)
+
+// Codes of the requirement errors returned by CreatePost, CreatePoll, CrossPost and CreateComment
+const (
+	ReputationTooLow   = "reputationTooLow"
+	PostTypeNotAllowed = "postTypeNotAllowed"
+	TitleTooShort      = "titleTooShort"
+	TitleTooLong       = "titleTooLong"
+	ContentTooShort    = "contentTooShort"
+	ContentTooLong     = "contentTooLong"
+)
+
+/*
+A rule of a community. Rules are numbered from 1 in the order the moderators listed them,
+and moderators cite the number when hiding content.
+*/
+type CommunityRule struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+/*
+What a community requires of new posts and comments. Zero values impose no requirement,
+and an empty AllowedPostTypes allows every post type.
+*/
+type PostingRequirements struct {
+	MinReputation    int      `json:"minReputation"` //moderators are exempt
+	AllowedPostTypes []string `json:"allowedPostTypes"`
+	MinTitleLength   int      `json:"minTitleLength"`
+	MaxTitleLength   int      `json:"maxTitleLength"`
+	MinContentLength int      `json:"minContentLength"` //applies to post content
+	MaxContentLength int      `json:"maxContentLength"`
+	MinCommentLength int      `json:"minCommentLength"`
+	MaxCommentLength int      `json:"maxCommentLength"`
+}
+
+type CommunityRules struct {
+	CommunityId  string              `json:"communityId"`
+	Rules        []CommunityRule     `json:"rules"`
+	Requirements PostingRequirements `json:"requirements"`
+}
+
+/*
+Returned when a post or comment doesn't meet its community's requirements. The error message is the JSON
+encoding of the error, so clients can tell which requirement failed and show the limit.
+*/
+type RequirementError struct {
+	Code    string   `json:"code"`
+	Field   string   `json:"field"`
+	Limit   int      `json:"limit,omitempty"`
+	Allowed []string `json:"allowed,omitempty"`
+	Message string   `json:"message"`
+}
+
+func (e *RequirementError) Error() string {
+	errorJson, _ := json.Marshal(e)
+	return string(errorJson)
+}
+
+type RulesEventPayload struct {
+	CommunityId  string              `json:"communityId"`
+	UserId       string              `json:"userId"`
+	Rules        []CommunityRule     `json:"rules"`
+	Requirements PostingRequirements `json:"requirements"`
+}
+
+func communityRequirements(community *Community) PostingRequirements {
+	if community.Requirements == nil {
+		return PostingRequirements{}
+	}
+	return *community.Requirements
+}
+
+func checkLength(value string, field string, min int, max int, tooShort string, tooLong string) error {
+	length := utf8.RuneCountInString(strings.TrimSpace(value))
+	if min > 0 && length < min {
+		return &RequirementError{Code: tooShort, Field: field, Limit: min, Message: fmt.Sprintf("%s must be at least %d characters", field, min)}
+	}
+	if max > 0 && length > max {
+		return &RequirementError{Code: tooLong, Field: field, Limit: max, Message: fmt.Sprintf("%s can't be longer than %d characters", field, max)}
+	}
+	return nil
+}
+
+/*
+Checks a new post of the given type against its community's requirements.
+*/
+func (s *SmartContract) checkPostRequirements(ctx contractapi.TransactionContextInterface, community *Community, author *User, postType string, title string, content string) error {
+	requirements := communityRequirements(community)
+	if len(requirements.AllowedPostTypes) > 0 && !contains(requirements.AllowedPostTypes, postType) {
+		return &RequirementError{Code: PostTypeNotAllowed, Field: "type", Allowed: requirements.AllowedPostTypes, Message: fmt.Sprintf("%s posts are not allowed in community %s", postType, community.Name)}
+	}
+	if requirements.MinReputation > 0 && !contains(community.Moderators, author.ID) {
+		reputation, err := s.getReputation(ctx, author)
+		if err != nil {
+			return err
+		}
+		if reputation < requirements.MinReputation {
+			return &RequirementError{Code: ReputationTooLow, Field: "reputation", Limit: requirements.MinReputation, Message: fmt.Sprintf("A reputation of at least %d is required to post in community %s", requirements.MinReputation, community.Name)}
+		}
+	}
+	err := checkLength(title, "title", requirements.MinTitleLength, requirements.MaxTitleLength, TitleTooShort, TitleTooLong)
+	if err != nil {
+		return err
+	}
+	return checkLength(content, "content", requirements.MinContentLength, requirements.MaxContentLength, ContentTooShort, ContentTooLong)
+}
+
+/*
+Checks a new comment against its community's requirements.
+*/
+func checkCommentRequirements(community *Community, content string) error {
+	requirements := communityRequirements(community)
+	return checkLength(content, "content", requirements.MinCommentLength, requirements.MaxCommentLength, ContentTooShort, ContentTooLong)
+}
+
+func validateRules(rules []CommunityRule) error {
+	if len(rules) > MaxCommunityRules {
+		return fmt.Errorf("A community can't have more than %d rules", MaxCommunityRules)
+	}
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Title) == "" {
+			return fmt.Errorf("Rule %d has no title", i+1)
+		}
+		if utf8.RuneCountInString(rule.Title) > MaxRuleTitleLength {
+			return fmt.Errorf("Rule %d title can't be longer than %d characters", i+1, MaxRuleTitleLength)
+		}
+		if utf8.RuneCountInString(rule.Description) > MaxRuleDescriptionLength {
+			return fmt.Errorf("Rule %d description can't be longer than %d characters", i+1, MaxRuleDescriptionLength)
+		}
+	}
+	return nil
+}
+
+func validateRequirements(requirements PostingRequirements) error {
+	for _, allowed := range requirements.AllowedPostTypes {
+		if allowed != PostTypeText && allowed != PostTypePoll {
+			return fmt.Errorf("Invalid post type %s", allowed)
+		}
+	}
+	bounds := []struct {
+		name     string
+		min, max int
+	}{
+		{"title", requirements.MinTitleLength, requirements.MaxTitleLength},
+		{"content", requirements.MinContentLength, requirements.MaxContentLength},
+		{"comment", requirements.MinCommentLength, requirements.MaxCommentLength},
+	}
+	for _, bound := range bounds {
+		if bound.min < 0 || bound.max < 0 {
+			return fmt.Errorf("Length bounds of %s can't be negative", bound.name)
+		}
+		if bound.max > 0 && bound.min > bound.max {
+			return fmt.Errorf("Minimum %s length can't exceed the maximum", bound.name)
+		}
+	}
+	if requirements.MinReputation < 0 {
+		return fmt.Errorf("Minimum reputation can't be negative")
+	}
+	return nil
+}
+
+func (s *SmartContract) saveRules(ctx contractapi.TransactionContextInterface, community *Community, userId string) (*CommunityRules, error) {
+	communityJson, _ := json.Marshal(community)
+	putState(ctx, communityObjectType, community.ID, communityJson)
+	rules := communityRules(community)
+	err := emitEvent(ctx, CommunityRulesChangedEvent, RulesEventPayload{CommunityId: community.ID, UserId: userId, Rules: rules.Rules, Requirements: rules.Requirements})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func communityRules(community *Community) *CommunityRules {
+	rules := CommunityRules{
+		CommunityId:  community.ID,
+		Rules:        community.Rules,
+		Requirements: communityRequirements(community),
+	}
+	if rules.Rules == nil {
+		rules.Rules = make([]CommunityRule, 0)
+	}
+	if rules.Requirements.AllowedPostTypes == nil {
+		rules.Requirements.AllowedPostTypes = make([]string, 0)
+	}
+	return &rules
+}
+
+/*
+Replaces a community's rule list. The rules are given as a JSON array of {"title", "description"} objects, in order.
+Only moderators of the community can edit its rules.
+*/
+func (s *SmartContract) SetCommunityRules(ctx contractapi.TransactionContextInterface, communityId string, rulesJson string, userId string) (*CommunityRules, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	var rules []CommunityRule
+	err = json.Unmarshal([]byte(rulesJson), &rules)
+	if err != nil {
+		return nil, fmt.Errorf("Rules must be a JSON array of rules: %w", err)
+	}
+	err = validateRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rules[i].Title = strings.TrimSpace(rules[i].Title)
+		rules[i].Description = strings.TrimSpace(rules[i].Description)
+	}
+	existingCommunity.Rules = rules
+	return s.saveRules(ctx, existingCommunity, userId)
+}
+
+/*
+Replaces a community's posting requirements, given as a JSON object. Only moderators of the community can edit them.
+*/
+func (s *SmartContract) SetPostingRequirements(ctx contractapi.TransactionContextInterface, communityId string, requirementsJson string, userId string) (*CommunityRules, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	var requirements PostingRequirements
+	err = json.Unmarshal([]byte(requirementsJson), &requirements)
+	if err != nil {
+		return nil, fmt.Errorf("Posting requirements must be a JSON object: %w", err)
+	}
+	err = validateRequirements(requirements)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity.Requirements = &requirements
+	return s.saveRules(ctx, existingCommunity, userId)
+}
+
+/*
+Returns a community's rules, in order, and its posting requirements.
+*/
+func (s *SmartContract) GetCommunityRules(ctx contractapi.TransactionContextInterface, communityId string) (*CommunityRules, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	return communityRules(existingCommunity), nil
+}
+
+/*
+Checks the rule number a moderator cites when hiding content. Zero cites no rule.
+*/
+func validateCitedRule(community *Community, rule int) error {
+	if rule < 0 || rule > len(community.Rules) {
+		return fmt.Errorf("Community %s has no rule %d", community.ID, rule)
+	}
+	return nil
+}
+
+/*
+Returns the rule cited by the most hide votes, the lowest numbered one on a tie, or zero if no vote cited a rule.
+*/
+func mostCitedRule(hideRules map[string]int) int {
+	counts := make(map[int]int)
+	for _, rule := range hideRules {
+		if rule > 0 {
+			counts[rule]++
+		}
+	}
+	rules := make([]int, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if counts[rules[i]] != counts[rules[j]] {
+			return counts[rules[i]] > counts[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	if len(rules) == 0 {
+		return 0
+	}
+	return rules[0]
+}
@@ -0,0 +1,53 @@
+package chaincode
+
+import "testing"
+
+func TestMostCitedRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		hideRules map[string]int
+		want      int
+	}{
+		{"no votes", nil, 0},
+		{"no rule cited", map[string]int{"m1": 0, "m2": 0}, 0},
+		{"single citation", map[string]int{"m1": 2}, 2},
+		{"uncited votes don't count", map[string]int{"m1": 0, "m2": 0, "m3": 3}, 3},
+		{"most citations", map[string]int{"m1": 1, "m2": 3, "m3": 3}, 3},
+		{"tie goes to the lowest rule", map[string]int{"m1": 4, "m2": 2}, 2},
+		{"tie among the most cited", map[string]int{"m1": 5, "m2": 5, "m3": 3, "m4": 3, "m5": 1}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mostCitedRule(test.hideRules); got != test.want {
+				t.Errorf("mostCitedRule(%v) = %d, want %d", test.hideRules, got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateRequirements(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements PostingRequirements
+		wantErr      bool
+	}{
+		{"empty", PostingRequirements{}, false},
+		{"allowed post types", PostingRequirements{AllowedPostTypes: []string{PostTypeText, PostTypePoll}}, false},
+		{"unknown post type", PostingRequirements{AllowedPostTypes: []string{PostTypeText, "video"}}, true},
+		{"bounded lengths", PostingRequirements{MinTitleLength: 5, MaxTitleLength: 100, MinContentLength: 1, MinCommentLength: 2, MaxCommentLength: 500}, false},
+		{"minimum equal to the maximum", PostingRequirements{MinTitleLength: 10, MaxTitleLength: 10}, false},
+		{"minimum without a maximum", PostingRequirements{MinContentLength: 1000}, false},
+		{"minimum above the maximum", PostingRequirements{MinCommentLength: 11, MaxCommentLength: 10}, true},
+		{"negative minimum", PostingRequirements{MinTitleLength: -1}, true},
+		{"negative maximum", PostingRequirements{MaxContentLength: -1}, true},
+		{"negative reputation", PostingRequirements{MinReputation: -1}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateRequirements(test.requirements)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateRequirements() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object types of a user's saved items: a record per saved item holding the sort key it was saved under,
+// and a time-ordered index entry, keyed like the public indexes, that GetSavedItems pages through.
+const (
+	savedItemObjectType = "savedItem"
+	savedItemIndex      = "savedItemIndex"
+)
+
+// Key of the transient field that carries the Id of the item to save or unsave
+const savedItemTransientKey = "itemId"
+
+type SavedItemsEventPayload struct {
+	UserId string `json:"userId"`
+}
+
+/*
+Saved items are kept in the implicit private data collection of the caller's organization, so they are
+neither written to the public world state nor disseminated to peers of other organizations.
+*/
+func savedItemsCollection(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspId, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read caller organization: %w", err)
+	}
+	return "_implicit_org_" + mspId, nil
+}
+
+/*
+Reads the Id of the item to save or unsave from the transient data, so it doesn't end up in the transaction recorded on the ledger.
+*/
+func savedItemId(ctx contractapi.TransactionContextInterface) (string, error) {
+	return transientField(ctx, savedItemTransientKey)
+}
+
+/*
+Saves a post or comment to the user's saved items. The item's Id is passed in the transient data under "itemId".
+Hidden items and items of private communities the user can't read can't be saved, and an item can be saved once.
+*/
+func (s *SmartContract) SavePost(ctx contractapi.TransactionContextInterface, userId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	itemId, err := savedItemId(ctx)
+	if err != nil {
+		return err
+	}
+	posts := make(map[string]*Post)
+	comments := make(map[string]*Comment)
+	readable, err := s.readableItems(ctx, userId, posts, comments, s.visibleItems(ctx, posts, comments))(itemId)
+	if err != nil {
+		return err
+	}
+	if !readable {
+		return fmt.Errorf("Post or comment with ID %s is hidden or in a private community and cannot be saved", itemId)
+	}
+	collection, err := savedItemsCollection(ctx)
+	if err != nil {
+		return err
+	}
+	recordKey, err := ctx.GetStub().CreateCompositeKey(savedItemObjectType, []string{userId, itemId})
+	if err != nil {
+		return err
+	}
+	existingRecord, err := ctx.GetStub().GetPrivateData(collection, recordKey)
+	if err != nil {
+		return fmt.Errorf("failed to read saved item: %w", err)
+	}
+	if existingRecord != nil {
+		return fmt.Errorf("Post or comment with ID %s is already saved", itemId)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	sortKey := indexSortKey(currentTime)
+	indexKey, err := ctx.GetStub().CreateCompositeKey(savedItemIndex, []string{userId, sortKey, itemId})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(collection, recordKey, []byte(sortKey))
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(collection, indexKey, []byte{0x00})
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, SavedItemsChangedEvent, SavedItemsEventPayload{UserId: userId})
+}
+
+/*
+Removes a post or comment from the user's saved items. The item's Id is passed in the transient data under "itemId".
+*/
+func (s *SmartContract) UnsavePost(ctx contractapi.TransactionContextInterface, userId string) error {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return err
+	}
+	itemId, err := savedItemId(ctx)
+	if err != nil {
+		return err
+	}
+	collection, err := savedItemsCollection(ctx)
+	if err != nil {
+		return err
+	}
+	recordKey, err := ctx.GetStub().CreateCompositeKey(savedItemObjectType, []string{userId, itemId})
+	if err != nil {
+		return err
+	}
+	sortKey, err := ctx.GetStub().GetPrivateData(collection, recordKey)
+	if err != nil {
+		return fmt.Errorf("failed to read saved item: %w", err)
+	}
+	if sortKey == nil {
+		return fmt.Errorf("Post or comment with ID %s isn't saved", itemId)
+	}
+	indexKey, err := ctx.GetStub().CreateCompositeKey(savedItemIndex, []string{userId, string(sortKey), itemId})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(collection, recordKey)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(collection, indexKey)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, SavedItemsChangedEvent, SavedItemsEventPayload{UserId: userId})
+}
+
+/*
+Returns the user's saved posts and comments, most recently saved first, as seen by the user. Only the user can read them.
+Items hidden or deleted since they were saved, and items of private communities the user can no longer read, are skipped.
+*/
+func (s *SmartContract) GetSavedItems(ctx contractapi.TransactionContextInterface, userId string, cursor string) (*PostOrCommentPage, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := savedItemsCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	posts := make(map[string]*Post)
+	comments := make(map[string]*Comment)
+	visibleItem := s.readableItems(ctx, userId, posts, comments, s.visibleItems(ctx, posts, comments))
+	entries, err := scanPrivateIndex(ctx, collection, savedItemIndex, []string{userId}, cursor, PostsPerPage+1, func(entry indexEntry, _ []byte) (bool, error) {
+		return visibleItem(entry.itemId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.postOrCommentPage(ctx, entries, posts, comments, userId)
+}
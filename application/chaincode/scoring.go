@@ -0,0 +1,306 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+How SelectModerator scores the members of a community. All arithmetic is on integers, so every peer
+computes the same scores. A member earns the weighted score of each of their posts and comments in the community,
+halved once for every full half-life since the item was created, plus points for the age of their account,
+and loses the penalty for each item moderators hid.
+*/
+type ModeratorScoring struct {
+	PostWeight          int `json:"postWeight"`
+	CommentWeight       int `json:"commentWeight"`
+	RecencyHalfLifeDays int `json:"recencyHalfLifeDays"` //0 disables decay
+	AccountAgeWeight    int `json:"accountAgeWeight"`    //points per day of account age
+	MaxAccountAgeDays   int `json:"maxAccountAgeDays"`   //days beyond this earn nothing more, 0 for no cap
+	MinAccountAgeDays   int `json:"minAccountAgeDays"`   //younger accounts aren't eligible
+	HiddenPenalty       int `json:"hiddenPenalty"`       //points lost for each post or comment hidden by moderators
+}
+
+type ModeratorScore struct {
+	UserId string `json:"userId"`
+	Score  int    `json:"score"`
+}
+
+type ScoringEventPayload struct {
+	CommunityId string           `json:"communityId"`
+	UserId      string           `json:"userId"`
+	Scoring     ModeratorScoring `json:"scoring"`
+}
+
+// Scoring of communities that haven't configured their own
+var defaultModeratorScoring = ModeratorScoring{
+	PostWeight:    1,
+	CommentWeight: 1,
+	HiddenPenalty: 5,
+}
+
+const day = 24 * time.Hour
+
+// SelectModerator first runs once a community is FirstModeratorSelectionDelay old, then every ModeratorSelectionMonths months
+const (
+	FirstModeratorSelectionDelay = 10 * time.Minute
+	ModeratorSelectionMonths     = 3
+)
+
+/*
+Returns when SelectModerator can next replace a community's moderators.
+*/
+func nextModeratorSelection(community *Community) time.Time {
+	if community.ModeratorsSelected.IsZero() {
+		return community.CreatedAt.Add(FirstModeratorSelectionDelay)
+	}
+	return community.ModeratorsSelected.AddDate(0, ModeratorSelectionMonths, 0)
+}
+
+func moderatorScoring(community *Community) ModeratorScoring {
+	if community.Scoring == nil {
+		return defaultModeratorScoring
+	}
+	return *community.Scoring
+}
+
+/*
+Halves a score once for every full half-life that has passed since the item was created.
+*/
+func decayedScore(score int, createdAt time.Time, now time.Time, halfLifeDays int) int {
+	if halfLifeDays <= 0 {
+		return score
+	}
+	halvings := int(now.Sub(createdAt) / (time.Duration(halfLifeDays) * day))
+	if halvings >= 63 {
+		return 0
+	}
+	if halvings > 0 {
+		score /= 1 << halvings
+	}
+	return score
+}
+
+/*
+Content is hidden both when its author deletes it and when moderators hide it; only the latter is decided by a moderation case.
+Content hidden before moderation cases existed carries the moderators' hide votes instead.
+*/
+func (s *SmartContract) hiddenByModerators(ctx contractapi.TransactionContextInterface, hidden bool, caseId string, hideVotes []string) (bool, error) {
+	if !hidden {
+		return false, nil
+	}
+	if caseId == "" {
+		return len(hideVotes) > 0, nil
+	}
+	moderationCase, err := s.getCase(ctx, caseId)
+	if err != nil || moderationCase == nil {
+		return false, err
+	}
+	return caseOutcome(moderationCase) == CaseHidden, nil
+}
+
+/*
+Scores a member's activity in a community. Cross-posts earn nothing, since votes on them go to the original post,
+and content the member deleted is skipped. Returns whether the member posted or commented in the community at all.
+*/
+func (s *SmartContract) memberActivityScore(ctx contractapi.TransactionContextInterface, communityId string, user *User, scoring ModeratorScoring, now time.Time) (int, bool, error) {
+	total := 0
+	active := false
+	for _, postId := range user.Posts {
+		existingPost, err := s.GetPost(ctx, postId)
+		if err != nil {
+			return 0, false, err
+		}
+		if existingPost == nil || existingPost.Community != communityId || existingPost.CrossPostOf != "" {
+			continue
+		}
+		active = true
+		hidden, err := s.hiddenByModerators(ctx, existingPost.Hidden, existingPost.Case, existingPost.HideVote)
+		if err != nil {
+			return 0, false, err
+		}
+		if hidden {
+			total -= scoring.HiddenPenalty
+			continue
+		}
+		if existingPost.Hidden {
+			continue
+		}
+		score, err := s.getScore(ctx, postId, existingPost.Score)
+		if err != nil {
+			return 0, false, err
+		}
+		total += decayedScore(score*scoring.PostWeight, existingPost.CreatedAt, now, scoring.RecencyHalfLifeDays)
+	}
+	for _, commentId := range user.Comments {
+		existingComment, err := s.GetComment(ctx, commentId)
+		if err != nil {
+			return 0, false, err
+		}
+		if existingComment == nil || existingComment.Community != communityId {
+			continue
+		}
+		active = true
+		hidden, err := s.hiddenByModerators(ctx, existingComment.Hidden, existingComment.Case, existingComment.HideVote)
+		if err != nil {
+			return 0, false, err
+		}
+		if hidden {
+			total -= scoring.HiddenPenalty
+			continue
+		}
+		if existingComment.Hidden {
+			continue
+		}
+		score, err := s.getScore(ctx, commentId, existingComment.Score)
+		if err != nil {
+			return 0, false, err
+		}
+		total += decayedScore(score*scoring.CommentWeight, existingComment.CreatedAt, now, scoring.RecencyHalfLifeDays)
+	}
+	return total, active, nil
+}
+
+/*
+Scores the members eligible to moderate a community, best first. Only current members who aren't banned,
+whose account is old enough and who have posted or commented in the community are eligible.
+Equal scores are ordered by user Id (see sortModeratorScores) so that every peer selects the same moderators.
+Accounts created before creation times were recorded count as zero days old.
+*/
+func (s *SmartContract) rankModeratorCandidates(ctx contractapi.TransactionContextInterface, community *Community) ([]ModeratorScore, error) {
+	scoring := moderatorScoring(community)
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]ModeratorScore, 0, len(community.Users))
+	for _, userId := range community.Users {
+		ban, err := s.activeBan(ctx, community.ID, userId)
+		if err != nil {
+			return nil, err
+		}
+		if ban != nil {
+			continue
+		}
+		existingUser, err := s.GetUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		if existingUser == nil {
+			continue
+		}
+		ageDays := 0
+		if !existingUser.CreatedAt.IsZero() {
+			ageDays = int(now.Sub(existingUser.CreatedAt) / day)
+		}
+		if ageDays < scoring.MinAccountAgeDays {
+			continue
+		}
+		score, active, err := s.memberActivityScore(ctx, community.ID, existingUser, scoring, now)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			continue
+		}
+		if scoring.MaxAccountAgeDays > 0 {
+			ageDays = min(ageDays, scoring.MaxAccountAgeDays)
+		}
+		score += ageDays * scoring.AccountAgeWeight
+		scores = append(scores, ModeratorScore{UserId: userId, Score: score})
+	}
+	sortModeratorScores(scores)
+	return scores, nil
+}
+
+/*
+Orders moderator candidates best first, equal scores by user Id.
+*/
+func sortModeratorScores(scores []ModeratorScore) {
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].UserId < scores[j].UserId
+	})
+}
+
+func validateScoring(scoring ModeratorScoring) error {
+	values := []struct {
+		name  string
+		value int
+	}{
+		{"postWeight", scoring.PostWeight},
+		{"commentWeight", scoring.CommentWeight},
+		{"recencyHalfLifeDays", scoring.RecencyHalfLifeDays},
+		{"accountAgeWeight", scoring.AccountAgeWeight},
+		{"maxAccountAgeDays", scoring.MaxAccountAgeDays},
+		{"minAccountAgeDays", scoring.MinAccountAgeDays},
+		{"hiddenPenalty", scoring.HiddenPenalty},
+	}
+	for _, value := range values {
+		if value.value < 0 {
+			return fmt.Errorf("Moderator scoring %s can't be negative", value.name)
+		}
+	}
+	return nil
+}
+
+/*
+Replaces the scoring SelectModerator uses for a community, given as a JSON object. Only moderators of the community can change it.
+*/
+func (s *SmartContract) SetModeratorScoring(ctx contractapi.TransactionContextInterface, communityId string, scoringJson string, userId string) (*ModeratorScoring, error) {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	var scoring ModeratorScoring
+	err = json.Unmarshal([]byte(scoringJson), &scoring)
+	if err != nil {
+		return nil, fmt.Errorf("Moderator scoring must be a JSON object: %w", err)
+	}
+	err = validateScoring(scoring)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity.Scoring = &scoring
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	err = emitEvent(ctx, ModeratorScoringChangedEvent, ScoringEventPayload{CommunityId: communityId, UserId: userId, Scoring: scoring})
+	if err != nil {
+		return nil, err
+	}
+	return &scoring, nil
+}
+
+/*
+Returns the scoring SelectModerator uses for a community.
+*/
+func (s *SmartContract) GetModeratorScoring(ctx contractapi.TransactionContextInterface, communityId string) (*ModeratorScoring, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	scoring := moderatorScoring(existingCommunity)
+	return &scoring, nil
+}
+
+/*
+Returns the eligible members of a community with their current moderator scores, best first,
+so members can see how the next selection would turn out.
+*/
+func (s *SmartContract) GetModeratorRanking(ctx contractapi.TransactionContextInterface, communityId string, userId string) ([]ModeratorScore, error) {
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCommunityReadable(ctx, existingCommunity, userId)
+	if err != nil {
+		return nil, err
+	}
+	return s.rankModeratorCandidates(ctx, existingCommunity)
+}
@@ -0,0 +1,60 @@
+package chaincode
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecayedScore(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		score        int
+		age          time.Duration
+		halfLifeDays int
+		want         int
+	}{
+		{"decay disabled", 100, 1000 * day, 0, 100},
+		{"negative half-life disables decay", 100, 1000 * day, -1, 100},
+		{"within the first half-life", 100, 29 * day, 30, 100},
+		{"one half-life", 100, 30 * day, 30, 50},
+		{"two half-lives", 100, 60 * day, 30, 25},
+		{"odd score rounds toward zero", 5, 30 * day, 30, 2},
+		{"negative score", -100, 30 * day, 30, -50},
+		{"zero score", 0, 30 * day, 30, 0},
+		{"62 half-lives", 1 << 62, 62 * day, 1, 1},
+		{"63 half-lives", 1 << 62, 63 * day, 1, 0},
+		{"created in the future", 100, -30 * day, 30, 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := decayedScore(test.score, createdAt, createdAt.Add(test.age), test.halfLifeDays)
+			if got != test.want {
+				t.Errorf("decayedScore(%d) = %d, want %d", test.score, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSortModeratorScores(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []ModeratorScore
+		want   []ModeratorScore
+	}{
+		{"empty", []ModeratorScore{}, []ModeratorScore{}},
+		{"single", []ModeratorScore{{"u1", 3}}, []ModeratorScore{{"u1", 3}}},
+		{"best first", []ModeratorScore{{"u1", 1}, {"u2", 5}, {"u3", -2}}, []ModeratorScore{{"u2", 5}, {"u1", 1}, {"u3", -2}}},
+		{"ties by user Id", []ModeratorScore{{"u3", 4}, {"u1", 4}, {"u2", 4}}, []ModeratorScore{{"u1", 4}, {"u2", 4}, {"u3", 4}}},
+		{"ties among other scores", []ModeratorScore{{"u4", 1}, {"u3", 7}, {"u2", 1}, {"u1", 7}}, []ModeratorScore{{"u1", 7}, {"u3", 7}, {"u2", 1}, {"u4", 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sortModeratorScores(test.scores)
+			if !reflect.DeepEqual(test.scores, test.want) {
+				t.Errorf("sorted scores = %v, want %v", test.scores, test.want)
+			}
+		})
+	}
+}
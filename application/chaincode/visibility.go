@@ -0,0 +1,359 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Community visibility modes. Anyone can read a public or restricted community, while only members can read a private one.
+// Anyone can join a public community; joining a restricted or private community takes a join request approved by a moderator.
+const (
+	CommunityPublic     = "public"
+	CommunityRestricted = "restricted"
+	CommunityPrivate    = "private"
+)
+
+// A pending join request is stored under (joinRequest, community, user) and in the community's time-ordered request queue
+const (
+	joinRequestObjectType = "joinRequest"
+	joinRequestIndex      = "joinRequestIndex"
+)
+
+const (
+	JoinRequestsPerPage         = 20
+	MaxJoinRequestMessageLength = 500
+)
+
+type JoinRequest struct {
+	CommunityId string    `json:"communityId"`
+	UserId      string    `json:"userId"`
+	Username    string    `json:"username"`
+	Message     string    `json:"message"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type JoinRequestPage struct {
+	Requests   []*JoinRequest `json:"requests"`
+	NextCursor string         `json:"nextCursor"` //empty on the last page
+}
+
+type VisibilityEventPayload struct {
+	CommunityId string `json:"communityId"`
+	UserId      string `json:"userId"`
+	Visibility  string `json:"visibility"`
+}
+
+/*
+Communities created before visibility modes existed have none and are public.
+*/
+func communityVisibility(community *Community) string {
+	if community.Visibility == "" {
+		return CommunityPublic
+	}
+	return community.Visibility
+}
+
+/*
+Returns whether the user can read a community's posts and comments. Reading a private community requires the
+caller to be a member acting as themselves, so the user Id passed to a read can't be borrowed.
+*/
+func canReadCommunity(ctx contractapi.TransactionContextInterface, community *Community, userId string) bool {
+	if communityVisibility(community) != CommunityPrivate {
+		return true
+	}
+	if !contains(community.Users, userId) && !contains(community.Moderators, userId) {
+		return false
+	}
+	return authorizeCaller(ctx, userId) == nil
+}
+
+func checkCommunityReadable(ctx contractapi.TransactionContextInterface, community *Community, userId string) error {
+	if !canReadCommunity(ctx, community, userId) {
+		return fmt.Errorf("Community with ID %s is private", community.ID)
+	}
+	return nil
+}
+
+/*
+Only approved members can post and comment in a restricted or private community.
+*/
+func checkCommunityPostable(community *Community, userId string) error {
+	if communityVisibility(community) != CommunityPublic && !contains(community.Users, userId) {
+		return fmt.Errorf("User cannot post as you are not an approved member of community %s", community.ID)
+	}
+	return nil
+}
+
+/*
+Wraps an accept function for scanIndexes so that it also drops posts of communities the user can't read.
+Used by feeds that span communities the user hasn't joined.
+*/
+func (s *SmartContract) readablePosts(ctx contractapi.TransactionContextInterface, userId string, posts map[string]*Post, accept func(string) (bool, error)) func(string) (bool, error) {
+	return s.readableItems(ctx, userId, posts, nil, accept)
+}
+
+/*
+Wraps an accept function for scanIndexes that caches the posts and comments it accepts in posts and comments,
+so that it also drops items of communities the user can't read. Communities are cached in communities.
+*/
+func (s *SmartContract) readableItems(ctx contractapi.TransactionContextInterface, userId string, posts map[string]*Post, comments map[string]*Comment, accept func(string) (bool, error)) func(string) (bool, error) {
+	communities := make(map[string]*Community)
+	return func(itemId string) (bool, error) {
+		accepted, err := accept(itemId)
+		if err != nil || !accepted {
+			return false, err
+		}
+		var communityId string
+		if post, ok := posts[itemId]; ok {
+			communityId = post.Community
+		} else {
+			communityId = comments[itemId].Community
+		}
+		community, ok := communities[communityId]
+		if !ok {
+			community, err = s.GetCommunity(ctx, communityId)
+			if err != nil {
+				return false, err
+			}
+			communities[communityId] = community
+		}
+		return canReadCommunity(ctx, community, userId), nil
+	}
+}
+
+func joinRequestKey(ctx contractapi.TransactionContextInterface, communityId string, userId string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(joinRequestObjectType, []string{communityId, userId})
+}
+
+func (s *SmartContract) getJoinRequest(ctx contractapi.TransactionContextInterface, communityId string, userId string) (*JoinRequest, error) {
+	key, err := joinRequestKey(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	requestJson, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read join request from ledger: %w", err)
+	}
+	if requestJson == nil {
+		return nil, nil
+	}
+	var request JoinRequest
+	err = json.Unmarshal(requestJson, &request)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func deleteJoinRequest(ctx contractapi.TransactionContextInterface, request *JoinRequest) error {
+	key, err := joinRequestKey(ctx, request.CommunityId, request.UserId)
+	if err != nil {
+		return err
+	}
+	indexKey, err := ctx.GetStub().CreateCompositeKey(joinRequestIndex, []string{request.CommunityId, indexSortKey(request.CreatedAt), request.UserId})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(indexKey)
+}
+
+/*
+Adds a user to a community's members and the community to the user's communities.
+*/
+func (s *SmartContract) addMember(ctx contractapi.TransactionContextInterface, community *Community, userId string) error {
+	currentUser, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if currentUser == nil {
+		return fmt.Errorf("user with ID %s doesn't exists", userId)
+	}
+	community.Users = append(community.Users, userId)
+	communityJson, _ := json.Marshal(community)
+	putState(ctx, communityObjectType, community.ID, communityJson)
+	currentUser.Communities = append(currentUser.Communities, community.ID)
+	userJson, _ := json.Marshal(currentUser)
+	putState(ctx, userObjectType, userId, userJson)
+	return nil
+}
+
+/*
+Changes who can read and join a community: "public", "restricted" or "private". Only moderators of the community can change it.
+Existing members stay members, and pending join requests can still be approved.
+*/
+func (s *SmartContract) SetCommunityVisibility(ctx contractapi.TransactionContextInterface, communityId string, visibility string, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	if visibility != CommunityPublic && visibility != CommunityRestricted && visibility != CommunityPrivate {
+		return fmt.Errorf("Invalid community visibility %s", visibility)
+	}
+	existingCommunity.Visibility = visibility
+	communityJson, _ := json.Marshal(existingCommunity)
+	putState(ctx, communityObjectType, communityId, communityJson)
+	return emitEvent(ctx, CommunityVisibilityChangedEvent, VisibilityEventPayload{CommunityId: communityId, UserId: userId, Visibility: visibility})
+}
+
+/*
+Asks to join a restricted or private community, with an optional message to the moderators.
+The request waits in the community's queue until a moderator approves or rejects it.
+*/
+func (s *SmartContract) RequestToJoin(ctx contractapi.TransactionContextInterface, communityId string, userId string, message string) (*JoinRequest, error) {
+	err := authorizeCaller(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	existingCommunity, err := s.GetCommunity(ctx, communityId)
+	if err != nil {
+		return nil, err
+	}
+	if communityVisibility(existingCommunity) == CommunityPublic {
+		return nil, fmt.Errorf("Community %s is public and can be joined directly", communityId)
+	}
+	if contains(existingCommunity.Users, userId) {
+		return nil, fmt.Errorf("User with ID %s is already a member of community %s", userId, communityId)
+	}
+	if len(message) > MaxJoinRequestMessageLength {
+		return nil, fmt.Errorf("Join request message can't be longer than %d characters", MaxJoinRequestMessageLength)
+	}
+	err = s.checkNotBanned(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	existingRequest, err := s.getJoinRequest(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existingRequest != nil {
+		return nil, fmt.Errorf("User with ID %s has already requested to join community %s", userId, communityId)
+	}
+	existingUser, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return nil, fmt.Errorf("User with ID %s doesn't exists", userId)
+	}
+	currentTime, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request := JoinRequest{
+		CommunityId: communityId,
+		UserId:      userId,
+		Username:    existingUser.Username,
+		Message:     message,
+		CreatedAt:   currentTime,
+	}
+	key, err := joinRequestKey(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	requestJson, _ := json.Marshal(request)
+	err = ctx.GetStub().PutState(key, requestJson)
+	if err != nil {
+		return nil, err
+	}
+	err = putIndexEntry(ctx, joinRequestIndex, communityId, currentTime, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, JoinRequestedEvent, MembershipEventPayload{CommunityId: communityId, UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+/*
+Approves a pending join request, making the requester a member. Only moderators of the community can approve requests.
+*/
+func (s *SmartContract) ApproveJoinRequest(ctx contractapi.TransactionContextInterface, communityId string, requesterId string, userId string) error {
+	existingCommunity, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	request, err := s.getJoinRequest(ctx, communityId, requesterId)
+	if err != nil {
+		return err
+	}
+	if request == nil {
+		return fmt.Errorf("User with ID %s has no pending request to join community %s", requesterId, communityId)
+	}
+	err = s.checkNotBanned(ctx, communityId, requesterId)
+	if err != nil {
+		return err
+	}
+	err = deleteJoinRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+	if !contains(existingCommunity.Users, requesterId) {
+		err = s.addMember(ctx, existingCommunity, requesterId)
+		if err != nil {
+			return err
+		}
+	}
+	return emitEvent(ctx, CommunityJoinedEvent, MembershipEventPayload{CommunityId: communityId, UserId: requesterId})
+}
+
+/*
+Rejects a pending join request. Only moderators of the community can reject requests; the user can ask again later.
+*/
+func (s *SmartContract) RejectJoinRequest(ctx contractapi.TransactionContextInterface, communityId string, requesterId string, userId string) error {
+	_, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return err
+	}
+	request, err := s.getJoinRequest(ctx, communityId, requesterId)
+	if err != nil {
+		return err
+	}
+	if request == nil {
+		return fmt.Errorf("User with ID %s has no pending request to join community %s", requesterId, communityId)
+	}
+	err = deleteJoinRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, JoinRequestRejectedEvent, MembershipEventPayload{CommunityId: communityId, UserId: requesterId})
+}
+
+/*
+Returns a page of a community's pending join requests, newest first. Only moderators of the community can read them.
+*/
+func (s *SmartContract) GetJoinRequests(ctx contractapi.TransactionContextInterface, communityId string, userId string, cursor string) (*JoinRequestPage, error) {
+	_, err := s.getModeratedCommunity(ctx, communityId, userId)
+	if err != nil {
+		return nil, err
+	}
+	requests := make(map[string]*JoinRequest)
+	entries, err := scanIndexes(ctx, joinRequestIndex, []string{communityId}, cursor, JoinRequestsPerPage+1, func(requesterId string) (bool, error) {
+		request, err := s.getJoinRequest(ctx, communityId, requesterId)
+		if err != nil || request == nil {
+			return false, err
+		}
+		requests[requesterId] = request
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, nextCursor := nextPage(entries, JoinRequestsPerPage)
+	page := JoinRequestPage{
+		Requests:   make([]*JoinRequest, 0, len(entries)),
+		NextCursor: nextCursor,
+	}
+	for _, entry := range entries {
+		page.Requests = append(page.Requests, requests[entry.itemId])
+	}
+	return &page, nil
+}
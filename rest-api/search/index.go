@@ -0,0 +1,207 @@
+// Package search keeps an in-memory inverted index of posts, comments and community names
+// and ranks matches for a free text query with BM25.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Types of indexed documents
+const (
+	PostDocument      = "post"
+	CommentDocument   = "comment"
+	CommunityDocument = "community"
+)
+
+// Each occurrence of a term in a title counts as this many occurrences in the content
+const titleWeight = 3
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Words too common to be worth indexing
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true, "with": true,
+}
+
+// Document is a searchable post, comment or community.
+// For a community, Title holds its name, Content its description and Community its own Id.
+type Document struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Community string    `json:"community"`
+	Author    string    `json:"author"`
+	Title     string    `json:"title,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Query is a free text search restricted by the optional Community, Author and Type filters.
+type Query struct {
+	Text      string
+	Community string
+	Author    string
+	Type      string
+}
+
+type Result struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+type indexedDocument struct {
+	document Document
+	terms    map[string]int // weighted term frequencies
+	length   int
+}
+
+// Index is an inverted index safe for concurrent use.
+type Index struct {
+	mu          sync.RWMutex
+	documents   map[string]*indexedDocument
+	postings    map[string]map[string]bool // term -> Ids of the documents containing it
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		documents: make(map[string]*indexedDocument),
+		postings:  make(map[string]map[string]bool),
+	}
+}
+
+// Tokenize lower cases text and splits it into words, dropping stop words.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// Put adds a document to the index, replacing any earlier version with the same Id.
+func (index *Index) Put(document Document) {
+	terms := make(map[string]int)
+	length := 0
+	for _, token := range Tokenize(document.Title) {
+		terms[token] += titleWeight
+		length += titleWeight
+	}
+	for _, token := range Tokenize(document.Content) {
+		terms[token]++
+		length++
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.remove(document.ID)
+	index.documents[document.ID] = &indexedDocument{document: document, terms: terms, length: length}
+	index.totalLength += length
+	for term := range terms {
+		if index.postings[term] == nil {
+			index.postings[term] = make(map[string]bool)
+		}
+		index.postings[term][document.ID] = true
+	}
+}
+
+// Remove drops a document from the index.
+func (index *Index) Remove(id string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.remove(id)
+}
+
+func (index *Index) remove(id string) {
+	indexed, ok := index.documents[id]
+	if !ok {
+		return
+	}
+	for term := range indexed.terms {
+		delete(index.postings[term], id)
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	index.totalLength -= indexed.length
+	delete(index.documents, id)
+}
+
+// Search returns the documents matching any term of the query that pass its filters, best match first.
+// Equal scores are ordered newest first, then by Id.
+func (index *Index) Search(query Query) []Result {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	results := make([]Result, 0)
+	if len(index.documents) == 0 {
+		return results
+	}
+	documentCount := float64(len(index.documents))
+	averageLength := float64(index.totalLength) / documentCount
+	scores := make(map[string]float64)
+	queried := make(map[string]bool)
+	for _, term := range Tokenize(query.Text) {
+		if queried[term] {
+			continue
+		}
+		queried[term] = true
+		matching := index.postings[term]
+		idf := math.Log(1 + (documentCount-float64(len(matching))+0.5)/(float64(len(matching))+0.5))
+		for id := range matching {
+			indexed := index.documents[id]
+			if !query.matches(indexed.document) {
+				continue
+			}
+			frequency := float64(indexed.terms[term])
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(indexed.length)/averageLength)
+			scores[id] += idf * frequency * (bm25K1 + 1) / (frequency + norm)
+		}
+	}
+	for id, score := range scores {
+		results = append(results, Result{Document: index.documents[id].document, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Precedes(results[j])
+	})
+	return results
+}
+
+// Precedes reports whether result is ranked before other: higher scores first, then newer documents, then by Id.
+func (result Result) Precedes(other Result) bool {
+	if result.Score != other.Score {
+		return result.Score > other.Score
+	}
+	if !result.CreatedAt.Equal(other.CreatedAt) {
+		return result.CreatedAt.After(other.CreatedAt)
+	}
+	return result.ID < other.ID
+}
+
+func (query Query) matches(document Document) bool {
+	if query.Community != "" && document.Community != query.Community {
+		return false
+	}
+	if query.Author != "" && document.Author != query.Author {
+		return false
+	}
+	if query.Type != "" && document.Type != query.Type {
+		return false
+	}
+	return true
+}
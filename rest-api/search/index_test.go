@@ -0,0 +1,170 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func resultIds(results []Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		documents []Document
+		query     Query
+		want      []string
+	}{
+		{
+			name:  "empty index",
+			query: Query{Text: "golang"},
+			want:  []string{},
+		},
+		{
+			name:      "empty query",
+			documents: []Document{{ID: "p1", Content: "golang"}},
+			query:     Query{},
+			want:      []string{},
+		},
+		{
+			name:      "stop words only",
+			documents: []Document{{ID: "p1", Content: "the golang of it"}},
+			query:     Query{Text: "the of it"},
+			want:      []string{},
+		},
+		{
+			name:      "no match",
+			documents: []Document{{ID: "p1", Content: "golang"}},
+			query:     Query{Text: "rust"},
+			want:      []string{},
+		},
+		{
+			name: "higher term frequency first",
+			documents: []Document{
+				{ID: "p1", Content: "golang chaincode ledger peer"},
+				{ID: "p2", Content: "golang golang golang peer"},
+			},
+			query: Query{Text: "golang"},
+			want:  []string{"p2", "p1"},
+		},
+		{
+			name: "title matches outweigh content matches",
+			documents: []Document{
+				{ID: "p1", Content: "golang peer"},
+				{ID: "p2", Title: "golang", Content: "peer"},
+			},
+			query: Query{Text: "golang"},
+			want:  []string{"p2", "p1"},
+		},
+		{
+			name: "rarer terms weigh more",
+			documents: []Document{
+				{ID: "p1", Content: "common words"},
+				{ID: "p2", Content: "common words"},
+				{ID: "p3", Content: "rare words"},
+			},
+			query: Query{Text: "common rare"},
+			want:  []string{"p3", "p1", "p2"},
+		},
+		{
+			name: "shorter documents first",
+			documents: []Document{
+				{ID: "p1", Content: "golang peer orderer channel ledger block"},
+				{ID: "p2", Content: "golang peer"},
+			},
+			query: Query{Text: "golang"},
+			want:  []string{"p2", "p1"},
+		},
+		{
+			name: "repeated query terms count once",
+			documents: []Document{
+				{ID: "p1", Content: "golang golang"},
+				{ID: "p2", Content: "golang ledger"},
+			},
+			query: Query{Text: "ledger golang golang golang"},
+			want:  []string{"p2", "p1"},
+		},
+		{
+			name: "ties newest first, then by Id",
+			documents: []Document{
+				{ID: "p2", Content: "golang", CreatedAt: testTime},
+				{ID: "p1", Content: "golang", CreatedAt: testTime},
+				{ID: "p3", Content: "golang", CreatedAt: testTime.Add(time.Hour)},
+			},
+			query: Query{Text: "golang"},
+			want:  []string{"p3", "p1", "p2"},
+		},
+		{
+			name: "filters",
+			documents: []Document{
+				{ID: "p1", Type: PostDocument, Community: "c1", Author: "u1", Content: "golang"},
+				{ID: "p2", Type: PostDocument, Community: "c2", Author: "u1", Content: "golang"},
+				{ID: "m1", Type: CommentDocument, Community: "c1", Author: "u1", Content: "golang"},
+				{ID: "p3", Type: PostDocument, Community: "c1", Author: "u2", Content: "golang"},
+			},
+			query: Query{Text: "golang", Community: "c1", Author: "u1", Type: PostDocument},
+			want:  []string{"p1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index := NewIndex()
+			for _, document := range test.documents {
+				index.Put(document)
+			}
+			if got := resultIds(index.Search(test.query)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Search(%+v) = %v, want %v", test.query, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPutReplacesAndRemoveDrops(t *testing.T) {
+	index := NewIndex()
+	index.Put(Document{ID: "p1", Content: "golang"})
+	index.Put(Document{ID: "p2", Content: "golang"})
+	index.Put(Document{ID: "p1", Content: "rust"})
+	if got := resultIds(index.Search(Query{Text: "golang"})); !reflect.DeepEqual(got, []string{"p2"}) {
+		t.Errorf("after replacing p1, golang matches %v, want [p2]", got)
+	}
+	index.Remove("p1")
+	index.Remove("missing")
+	if got := resultIds(index.Search(Query{Text: "rust"})); len(got) != 0 {
+		t.Errorf("after removing p1, rust matches %v, want none", got)
+	}
+	if index.totalLength != 1 || len(index.postings) != 1 {
+		t.Errorf("index keeps %d terms of length %d, want 1 of length 1", len(index.postings), index.totalLength)
+	}
+}
+
+func TestPrecedes(t *testing.T) {
+	result := func(id string, score float64, createdAt time.Time) Result {
+		return Result{Document: Document{ID: id, CreatedAt: createdAt}, Score: score}
+	}
+	tests := []struct {
+		name        string
+		first, then Result
+		want        bool
+	}{
+		{"higher score", result("p2", 2, testTime), result("p1", 1, testTime.Add(time.Hour)), true},
+		{"lower score", result("p1", 1, testTime), result("p2", 2, testTime), false},
+		{"equal score, newer", result("p2", 1, testTime.Add(time.Hour)), result("p1", 1, testTime), true},
+		{"equal score and time, lower Id", result("p1", 1, testTime), result("p2", 1, testTime), true},
+		{"itself", result("p1", 1, testTime), result("p1", 1, testTime), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.first.Precedes(test.then); got != test.want {
+				t.Errorf("Precedes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
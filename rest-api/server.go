@@ -174,6 +174,7 @@ func main() {
 		TLSCertPath:  cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt",
 		PeerEndpoint: "0.0.0.0:7051",
 		GatewayPeer:  "peer0.org1.example.com",
+		WalletPath:   "wallet",
 	}
 	orgSetup, err := web.Initialize(orgConfig)
 	if err != nil {
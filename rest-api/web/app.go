@@ -22,9 +22,15 @@ type OrgSetup struct {
 	TLSCertPath  string
 	PeerEndpoint string
 	GatewayPeer  string
+	WalletPath   string
 	Gateway      client.Gateway
 }
 
+type contextKey string
+
+// userIdContextKey holds the user Id taken from a verified token in the request context.
+const userIdContextKey contextKey = "userId"
+
 func startTunnel(ctx context.Context) error {
 	listener, err := ngrok.Listen(ctx,
 		config.HTTPEndpoint(
@@ -73,14 +79,14 @@ func AuthMiddleware(handlerFunc func(http.ResponseWriter, *http.Request)) func(h
 		}
 
 		// Verify the token
-		_, err := verifyToken(tokenString)
+		userId, err := verifyToken(tokenString)
 		if err != nil {
 			http.Error(w, "Logout and login again", http.StatusUnauthorized)
 			return
 		}
 
-		// If the token is valid, proceed with the request
-		handlerFunc(w, r)
+		// If the token is valid, proceed with the request as that user
+		handlerFunc(w, r.WithContext(context.WithValue(r.Context(), userIdContextKey, userId)))
 	}
 }
 
@@ -92,6 +98,8 @@ func Serve(setups OrgSetup) {
 	// 	fmt.Println(err)
 	// }
 
+	go setups.IndexEvents(context.Background())
+	go setups.ScheduleOpenCases(context.Background())
 	http.HandleFunc("/channel", AuthMiddleware(http.HandlerFunc(setups.Query)))
 	http.HandleFunc("/post", AuthMiddleware(http.HandlerFunc(setups.GetPost)))
 	http.HandleFunc("/user", AuthMiddleware(http.HandlerFunc(setups.GetUser)))
@@ -119,6 +127,67 @@ func Serve(setups OrgSetup) {
 	// http.HandleFunc("/moderator", setups.SelectModerator)
 	http.HandleFunc("/show", AuthMiddleware(http.HandlerFunc(setups.ShowPostModerator)))
 	http.HandleFunc("/unappeal", AuthMiddleware(http.HandlerFunc(setups.UnAppealPost)))
+	http.HandleFunc("/post/edit", AuthMiddleware(http.HandlerFunc(setups.EditPost)))
+	http.HandleFunc("/comment/edit", AuthMiddleware(http.HandlerFunc(setups.EditComment)))
+	http.HandleFunc("/revisions", AuthMiddleware(http.HandlerFunc(setups.GetRevisionHistory)))
+	http.HandleFunc("/history", AuthMiddleware(http.HandlerFunc(setups.GetItemHistory)))
+	http.HandleFunc("/community/flairs", AuthMiddleware(http.HandlerFunc(setups.GetCommunityFlairs)))
+	http.HandleFunc("/community/flair/add", AuthMiddleware(http.HandlerFunc(setups.AddFlair)))
+	http.HandleFunc("/community/flair/update", AuthMiddleware(http.HandlerFunc(setups.UpdateFlair)))
+	http.HandleFunc("/community/rules", AuthMiddleware(http.HandlerFunc(setups.GetCommunityRules)))
+	http.HandleFunc("/community/rules/set", AuthMiddleware(http.HandlerFunc(setups.SetCommunityRules)))
+	http.HandleFunc("/community/requirements/set", AuthMiddleware(http.HandlerFunc(setups.SetPostingRequirements)))
+	http.HandleFunc("/community/flair/remove", AuthMiddleware(http.HandlerFunc(setups.RemoveFlair)))
+	http.HandleFunc("/community/visibility", AuthMiddleware(http.HandlerFunc(setups.SetCommunityVisibility)))
+	http.HandleFunc("/community/join_request", AuthMiddleware(http.HandlerFunc(setups.RequestToJoin)))
+	http.HandleFunc("/community/join_requests", AuthMiddleware(http.HandlerFunc(setups.GetJoinRequests)))
+	http.HandleFunc("/community/join_requests/approve", AuthMiddleware(http.HandlerFunc(setups.ApproveJoinRequest)))
+	http.HandleFunc("/community/join_requests/reject", AuthMiddleware(http.HandlerFunc(setups.RejectJoinRequest)))
+	http.HandleFunc("/community/bans", AuthMiddleware(http.HandlerFunc(setups.GetCommunityBans)))
+	http.HandleFunc("/community/ban", AuthMiddleware(http.HandlerFunc(setups.BanUser)))
+	http.HandleFunc("/community/unban", AuthMiddleware(http.HandlerFunc(setups.UnbanUser)))
+	http.HandleFunc("/community/moderators/add", AuthMiddleware(http.HandlerFunc(setups.AddModerator)))
+	http.HandleFunc("/community/moderators/remove", AuthMiddleware(http.HandlerFunc(setups.RemoveModerator)))
+	http.HandleFunc("/community/modlog", AuthMiddleware(http.HandlerFunc(setups.GetModLog)))
+	http.HandleFunc("/community/moderator_selection", AuthMiddleware(http.HandlerFunc(setups.SetModeratorSelection)))
+	http.HandleFunc("/community/moderator_scoring", AuthMiddleware(http.HandlerFunc(setups.GetModeratorScoring)))
+	http.HandleFunc("/community/moderator_scoring/set", AuthMiddleware(http.HandlerFunc(setups.SetModeratorScoring)))
+	http.HandleFunc("/community/moderator_ranking", AuthMiddleware(http.HandlerFunc(setups.GetModeratorRanking)))
+	http.HandleFunc("/community/appeal_threshold", AuthMiddleware(http.HandlerFunc(setups.SetAppealThreshold)))
+	http.HandleFunc("/community/case_policy", AuthMiddleware(http.HandlerFunc(setups.GetCasePolicy)))
+	http.HandleFunc("/community/case_policy/set", AuthMiddleware(http.HandlerFunc(setups.SetCasePolicy)))
+	http.HandleFunc("/case", AuthMiddleware(http.HandlerFunc(setups.GetModerationCase)))
+	http.HandleFunc("/case/expire", AuthMiddleware(http.HandlerFunc(setups.ExpireCase)))
+	http.HandleFunc("/community/elections", AuthMiddleware(http.HandlerFunc(setups.GetCommunityElections)))
+	http.HandleFunc("/election", AuthMiddleware(http.HandlerFunc(setups.GetElection)))
+	http.HandleFunc("/election/start", AuthMiddleware(http.HandlerFunc(setups.StartElection)))
+	http.HandleFunc("/election/nominate", AuthMiddleware(http.HandlerFunc(setups.NominateCandidate)))
+	http.HandleFunc("/election/ballot", AuthMiddleware(http.HandlerFunc(setups.GetBallot)))
+	http.HandleFunc("/election/vote", AuthMiddleware(http.HandlerFunc(setups.CastBallot)))
+	http.HandleFunc("/election/close", AuthMiddleware(http.HandlerFunc(setups.CloseElection)))
+	http.HandleFunc("/post/crosspost", AuthMiddleware(http.HandlerFunc(setups.CrossPost)))
+	http.HandleFunc("/create/poll", AuthMiddleware(http.HandlerFunc(setups.CreatePoll)))
+	http.HandleFunc("/poll/vote", AuthMiddleware(http.HandlerFunc(setups.CastPollVote)))
+	http.HandleFunc("/poll/results", AuthMiddleware(http.HandlerFunc(setups.GetPollResults)))
+	http.HandleFunc("/saved", AuthMiddleware(http.HandlerFunc(setups.GetSavedItems)))
+	http.HandleFunc("/saved/save", AuthMiddleware(http.HandlerFunc(setups.SavePost)))
+	http.HandleFunc("/saved/unsave", AuthMiddleware(http.HandlerFunc(setups.UnsavePost)))
+	http.HandleFunc("/messages", AuthMiddleware(http.HandlerFunc(setups.GetConversations)))
+	http.HandleFunc("/messages/conversation", AuthMiddleware(http.HandlerFunc(setups.GetMessages)))
+	http.HandleFunc("/messages/unread", AuthMiddleware(http.HandlerFunc(setups.GetUnreadMessageCount)))
+	http.HandleFunc("/messages/send", AuthMiddleware(http.HandlerFunc(setups.SendMessage)))
+	http.HandleFunc("/messages/read", AuthMiddleware(http.HandlerFunc(setups.MarkConversationRead)))
+	http.HandleFunc("/notifications", AuthMiddleware(http.HandlerFunc(setups.GetNotifications)))
+	http.HandleFunc("/notifications/unread", AuthMiddleware(http.HandlerFunc(setups.GetUnreadNotificationCount)))
+	http.HandleFunc("/notifications/read", AuthMiddleware(http.HandlerFunc(setups.MarkNotificationRead)))
+	http.HandleFunc("/notifications/read_all", AuthMiddleware(http.HandlerFunc(setups.MarkAllNotificationsRead)))
+	http.HandleFunc("/notifications/preferences", AuthMiddleware(http.HandlerFunc(setups.GetNotificationPreferences)))
+	http.HandleFunc("/notifications/preferences/set", AuthMiddleware(http.HandlerFunc(setups.SetNotificationPreference)))
+	http.HandleFunc("/user/follow", AuthMiddleware(http.HandlerFunc(setups.FollowUser)))
+	http.HandleFunc("/user/unfollow", AuthMiddleware(http.HandlerFunc(setups.UnfollowUser)))
+	http.HandleFunc("/user_profile/followers", AuthMiddleware(http.HandlerFunc(setups.GetFollowers)))
+	http.HandleFunc("/user_profile/following", AuthMiddleware(http.HandlerFunc(setups.GetFollowing)))
+	http.HandleFunc("/search", AuthMiddleware(http.HandlerFunc(setups.Search)))
 	http.HandleFunc("/login", setups.Login)
 	//fmt.Printf("Listening (%s)...\n", listener.URL())
 	// if err := http.Serve(listener, nil); err != nil {
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+/*
+Finds a requirement error returned by the chaincode, such as a post that breaks its community's length bounds.
+The chaincode encodes these as JSON objects with a "code" field, and the gateway reports them in the error details of the failed endorsement.
+*/
+func requirementError(err error) (string, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		errorDetail, ok := detail.(interface{ GetMessage() string })
+		if !ok {
+			continue
+		}
+		message := errorDetail.GetMessage()
+		start := strings.Index(message, "{")
+		if start == -1 {
+			continue
+		}
+		var parsed struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal([]byte(message[start:]), &parsed) == nil && parsed.Code != "" {
+			return message[start:], true
+		}
+	}
+	return "", false
+}
+
+/*
+Reports a failed endorsement, passing requirement errors on to the client as JSON with status 422.
+*/
+func endorseError(w http.ResponseWriter, err error, errorMessage string) {
+	if requirement, ok := requirementError(err); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%s", requirement)
+		return
+	}
+	http.Error(w, errorMessage, http.StatusInternalServerError)
+}
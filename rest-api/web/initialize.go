@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
@@ -21,7 +23,17 @@ func Initialize(setup OrgSetup) (*OrgSetup, error) {
 	id := setup.newIdentity()
 	sign := setup.newSign()
 
-	gateway, err := client.Connect(
+	gateway, err := connect(id, sign, clientConnection)
+	if err != nil {
+		panic(err)
+	}
+	setup.Gateway = *gateway
+	log.Println("Initialization complete")
+	return &setup, nil
+}
+
+func connect(id identity.Identity, sign identity.Sign, clientConnection *grpc.ClientConn) (*client.Gateway, error) {
+	return client.Connect(
 		id,
 		client.WithSign(sign),
 		client.WithClientConnection(clientConnection),
@@ -30,12 +42,67 @@ func Initialize(setup OrgSetup) (*OrgSetup, error) {
 		client.WithSubmitTimeout(5*time.Second),
 		client.WithCommitStatusTimeout(1*time.Minute),
 	)
+}
+
+// userGateways caches one Gateway connection per user, keyed by user Id.
+var (
+	userGateways   = make(map[string]*client.Gateway)
+	userGatewaysMu sync.Mutex
+)
+
+// userGateway returns a Gateway connection that signs with the user's own enrolled identity, read from
+// WalletPath/<userId>/signcerts and WalletPath/<userId>/keystore, so the chaincode can check who is acting.
+func (setup OrgSetup) userGateway(userId string) (*client.Gateway, error) {
+	userGatewaysMu.Lock()
+	defer userGatewaysMu.Unlock()
+	if gateway, ok := userGateways[userId]; ok {
+		return gateway, nil
+	}
+
+	certificate, err := loadCertificate(path.Join(setup.WalletPath, userId, "signcerts", "cert.pem"))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	setup.Gateway = *gateway
-	log.Println("Initialization complete")
-	return &setup, nil
+	id, err := identity.NewX509Identity(setup.MSPID, certificate)
+	if err != nil {
+		return nil, err
+	}
+	keyPath := path.Join(setup.WalletPath, userId, "keystore")
+	files, err := ioutil.ReadDir(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no private key found for user %s", userId)
+	}
+	privateKeyPEM, err := ioutil.ReadFile(path.Join(keyPath, files[0].Name()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := connect(id, sign, setup.newGrpcConnection())
+	if err != nil {
+		return nil, err
+	}
+	userGateways[userId] = gateway
+	return gateway, nil
+}
+
+// callerGateway returns the Gateway of the user that AuthMiddleware authenticated for this request.
+func (setup OrgSetup) callerGateway(r *http.Request) (*client.Gateway, error) {
+	userId, ok := r.Context().Value(userIdContextKey).(string)
+	if !ok || userId == "" {
+		return nil, fmt.Errorf("request has no authenticated user")
+	}
+	return setup.userGateway(userId)
 }
 
 // newGrpcConnection creates a gRPC connection to the Gateway server.
@@ -1,17 +1,20 @@
 package web
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"encoding/json"
 	"io/ioutil"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/google/uuid"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
@@ -32,12 +35,6 @@ func generateToken(username string) (string, error) {
 	return tokenString, nil
 }
 
-func TodayDateTime() string {
-	current := time.Now().UTC()
-	formattedDate := current.Format("2006-01-02T15:04:05.000Z")
-	return formattedDate
-}
-
 type ScheduledTask struct {
 	Id        string    `json:"id"`
 	Execution time.Time `json:"execution"`
@@ -96,20 +93,16 @@ func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	communityId, err := uuid.NewV7()
+	gateway, err := setup.callerGateway(r)
 	if err != nil {
-		fmt.Fprintf(w, "Error community id %s", err)
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
 		return
 	}
-	dateTime := TodayDateTime()
-	newCommunityId := "co" + dateTime + "_" + communityId.String()
-	additionalArgs := []string{newCommunityId, dateTime}
-	fmt.Println(newCommunityId)
-	combinedArgs := append(additionalArgs, args...)
-	network := setup.Gateway.GetNetwork(channelID)
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(combinedArgs...))
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
 	if err != nil {
 		http.Error(w, "Error in creating community", http.StatusInternalServerError)
 		fmt.Printf("Error creating txn proposal: %s", err)
@@ -129,15 +122,21 @@ func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println(txn_committed.TransactionID())
 	//fmt.Fprintf(w, "%s", txn_committed.TransactionID())
-	dateTimeObj, err := time.Parse("2006-01-02T15:04:05.000Z", dateTime)
+	var community struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	err = json.Unmarshal(txn_endorsed.Result(), &community)
 	if err != nil {
-		fmt.Printf("Error in converting datetime in community")
+		http.Error(w, "Error in creating community", http.StatusInternalServerError)
+		fmt.Printf("Error reading created community: %s", err)
 		return
 	}
+	newCommunityId := community.ID
 
 	task := ScheduledTask{
 		Id:        newCommunityId,
-		Execution: dateTimeObj.Add(10 * time.Minute),
+		Execution: community.CreatedAt.Add(10 * time.Minute),
 	}
 	saveTaskToFile(task)
 	duration := task.Execution.Sub(time.Now().UTC())
@@ -165,7 +164,13 @@ func (setup *OrgSetup) JoinCommunity(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -206,7 +211,13 @@ func (setup *OrgSetup) UnJoinCommunity(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -247,19 +258,15 @@ func (setup *OrgSetup) CreatePost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
-	contract := network.GetContract(chainCodeName)
-	postId, err := uuid.NewV7()
+	gateway, err := setup.callerGateway(r)
 	if err != nil {
-		fmt.Fprintf(w, "Error post id %s", err)
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
 		return
 	}
-	dateTime := TodayDateTime()
-	newPostId := "p" + dateTime + "_" + postId.String()
-	additionalArgs := []string{newPostId, dateTime}
-	fmt.Println(newPostId)
-	combinedArgs := append(additionalArgs, args...)
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(combinedArgs...))
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
 		http.Error(w, "Error in creating post", http.StatusInternalServerError)
@@ -268,7 +275,7 @@ func (setup *OrgSetup) CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 	txn_endorsed, err := txn_proposal.Endorse()
 	if err != nil {
-		http.Error(w, "Error in creating post", http.StatusInternalServerError)
+		endorseError(w, err, "Error in creating post")
 		fmt.Printf("Error endorsing txn: %s", err)
 		return
 	}
@@ -299,7 +306,11 @@ func (setup *OrgSetup) CreateUser(userId string, username string, email string)
 	// 	fmt.Println(value)
 	// }
 	//fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.userGateway(userId)
+	if err != nil {
+		return err
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(userId, username, email))
 	if err != nil {
@@ -339,7 +350,13 @@ func (setup *OrgSetup) UpVotePost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -382,7 +399,13 @@ func (setup *OrgSetup) UndoUpVotePost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -424,7 +447,13 @@ func (setup *OrgSetup) DownVotePost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -466,7 +495,13 @@ func (setup *OrgSetup) UndoDownVotePost(w http.ResponseWriter, r *http.Request)
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -508,20 +543,16 @@ func (setup *OrgSetup) CreateComment(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
-	contract := network.GetContract(chainCodeName)
-	postId, err := uuid.NewV7()
+	gateway, err := setup.callerGateway(r)
 	if err != nil {
-		fmt.Fprintf(w, "Error post id %s", err)
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
 		return
 	}
-	dateTime := TodayDateTime()
-	newPostId := "c" + dateTime + "_" + postId.String()
-	additionalArgs := []string{newPostId, dateTime}
-	fmt.Println(newPostId)
-	combinedArgs := append(additionalArgs, args...)
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(combinedArgs...))
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
 	if err != nil {
 		http.Error(w, "Error in creating comment", http.StatusInternalServerError)
 		fmt.Printf("Error creating txn proposal: %s", err)
@@ -529,7 +560,7 @@ func (setup *OrgSetup) CreateComment(w http.ResponseWriter, r *http.Request) {
 	}
 	txn_endorsed, err := txn_proposal.Endorse()
 	if err != nil {
-		http.Error(w, "Error in creating comment", http.StatusInternalServerError)
+		endorseError(w, err, "Error in creating comment")
 		fmt.Printf("Error endorsing txn: %s", err)
 		return
 	}
@@ -560,7 +591,13 @@ func (setup *OrgSetup) DeletePost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -602,7 +639,13 @@ func (setup *OrgSetup) AppealPost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
@@ -625,6 +668,21 @@ func (setup *OrgSetup) AppealPost(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println(txn_committed.TransactionID())
 	//fmt.Fprintf(w, "%s", txn_committed.TransactionID())
+	if len(txn_endorsed.Result()) > 0 {
+		var moderationCase *struct {
+			ID       string    `json:"id"`
+			Deadline time.Time `json:"deadline"`
+		}
+		err = json.Unmarshal(txn_endorsed.Result(), &moderationCase)
+		if err != nil {
+			http.Error(w, "Error in appealing post", http.StatusInternalServerError)
+			fmt.Printf("Error reading moderation case: %s", err)
+			return
+		}
+		if moderationCase != nil && moderationCase.ID != "" { // null while the item has too few appeals
+			setup.scheduleCaseExpiry(moderationCase.ID, moderationCase.Deadline)
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	//fmt.Fprintf(w, "%s", txn_committed.TransactionID())
 	fmt.Fprintf(w, "%s", txn_endorsed.Result())
@@ -640,11 +698,20 @@ func (setup *OrgSetup) HidePostModerator(w http.ResponseWriter, r *http.Request)
 	channelID := "mychannel"
 	function := "HidePostModerator"
 	args := r.Form["args"]
+	if len(args) == 2 {
+		args = append(args, "0") // no community rule cited
+	}
 	for _, value := range args {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
 	if err != nil {
@@ -685,7 +752,13 @@ func (setup *OrgSetup) ShowPostModerator(w http.ResponseWriter, r *http.Request)
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
 	if err != nil {
@@ -776,7 +849,13 @@ func (setup *OrgSetup) UnAppealPost(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(value)
 	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
 	if err != nil {
@@ -796,10 +875,1630 @@ func (setup *OrgSetup) UnAppealPost(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Transaction ID : %s Response: %s", txn_committed.TransactionID(), txn_endorsed.Result())
 }
 
+func (setup *OrgSetup) EditPost(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "EditPost"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in editing post", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in editing post", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in editing post", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) EditComment(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "EditComment"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in editing comment", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in editing comment", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in editing comment", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
 type Response struct {
 	Data map[string]interface{} `json:"data"`
 }
 
+func (setup *OrgSetup) AddFlair(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "AddFlair"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in adding flair", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in adding flair", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in adding flair", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) UpdateFlair(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "UpdateFlair"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in updating flair", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in updating flair", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in updating flair", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) RemoveFlair(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "RemoveFlair"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in removing flair", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in removing flair", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in removing flair", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) CreatePoll(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "CreatePoll"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in creating poll", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		endorseError(w, err, "Error in creating poll")
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in creating poll", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) CastPollVote(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "CastPollVote"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in casting poll vote", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in casting poll vote", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in casting poll vote", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) CrossPost(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "CrossPost"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in cross-posting", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		endorseError(w, err, "Error in cross-posting")
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in cross-posting", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) FollowUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "FollowUser"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in following user", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in following user", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in following user", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "UnfollowUser"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in unfollowing user", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in unfollowing user", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in unfollowing user", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "MarkNotificationRead"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in marking notification read", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in marking notification read", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in marking notification read", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "MarkAllNotificationsRead"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in marking notifications read", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in marking notifications read", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in marking notifications read", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetNotificationPreference"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in setting notification preference", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in setting notification preference", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in setting notification preference", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetCommunityRules(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetCommunityRules"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in setting community rules", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in setting community rules", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in setting community rules", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetPostingRequirements(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetPostingRequirements"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in setting posting requirements", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in setting posting requirements", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in setting posting requirements", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+func (setup *OrgSetup) BanUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "BanUser"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in banning user", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in banning user", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in banning user", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "UnbanUser"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in unbanning user", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in unbanning user", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in unbanning user", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) AddModerator(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "AddModerator"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in adding moderator", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in adding moderator", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in adding moderator", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) RemoveModerator(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "RemoveModerator"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in removing moderator", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in removing moderator", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in removing moderator", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) StartElection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "StartElection"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in starting election", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in starting election", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in starting election", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	var election struct {
+		ID             string    `json:"id"`
+		VotingClosesAt time.Time `json:"votingClosesAt"`
+	}
+	err = json.Unmarshal(txn_endorsed.Result(), &election)
+	if err != nil {
+		http.Error(w, "Error in starting election", http.StatusInternalServerError)
+		fmt.Printf("Error reading started election: %s", err)
+		return
+	}
+	time.AfterFunc(election.VotingClosesAt.Sub(time.Now().UTC()), func() {
+		setup.closeElection(election.ID)
+	})
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+/*
+Tallies an election once its voting window has ended. Scheduled by StartElection; members can also close
+an ended election themselves through CloseElection if the service restarted in between.
+*/
+func (setup *OrgSetup) closeElection(electionId string) {
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "CloseElection"
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, electionId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(electionId))
+	if err != nil {
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+}
+
+// Moderation cases whose expiry is already scheduled; later appeals and every sweep of ScheduleOpenCases return open cases again
+var scheduledCases = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: make(map[string]bool)}
+
+func (setup *OrgSetup) scheduleCaseExpiry(caseId string, deadline time.Time) {
+	scheduledCases.Lock()
+	defer scheduledCases.Unlock()
+	if scheduledCases.ids[caseId] {
+		return
+	}
+	scheduledCases.ids[caseId] = true
+	time.AfterFunc(deadline.Sub(time.Now().UTC()), func() {
+		setup.expireCase(caseId)
+		scheduledCases.Lock()
+		delete(scheduledCases.ids, caseId)
+		scheduledCases.Unlock()
+	})
+}
+
+// How often the service looks for open moderation cases it hasn't scheduled, such as cases opened by other instances
+const caseSweepInterval = 10 * time.Minute
+
+/*
+Schedules the expiry of every open moderation case, at startup and then every caseSweepInterval, so cases opened
+before a restart, by other instances or by InitLedger still expire. Overdue cases are expired right away.
+*/
+func (setup *OrgSetup) ScheduleOpenCases(ctx context.Context) {
+	for {
+		setup.scheduleOpenCases()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(caseSweepInterval):
+		}
+	}
+}
+
+func (setup *OrgSetup) scheduleOpenCases() {
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetOpenCases"
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	cursor := ""
+	for {
+		evaluateResponse, err := contract.EvaluateTransaction(function, cursor)
+		if err != nil {
+			fmt.Printf("Error listing open moderation cases: %s", err)
+			return
+		}
+		var page struct {
+			Cases []struct {
+				CaseId   string    `json:"caseId"`
+				Deadline time.Time `json:"deadline"`
+			} `json:"cases"`
+			NextCursor string `json:"nextCursor"`
+		}
+		err = json.Unmarshal(evaluateResponse, &page)
+		if err != nil {
+			fmt.Printf("Error reading open moderation cases: %s", err)
+			return
+		}
+		for _, openCase := range page.Cases {
+			setup.scheduleCaseExpiry(openCase.CaseId, openCase.Deadline)
+		}
+		if page.NextCursor == "" {
+			return
+		}
+		cursor = page.NextCursor
+	}
+}
+
+/*
+Applies the default outcome to a moderation case its moderators didn't decide in time. Scheduled by AppealPost and
+ScheduleOpenCases; anyone can also expire an overdue case through ExpireCase. Cases decided before the deadline fail here harmlessly.
+*/
+func (setup *OrgSetup) expireCase(caseId string) {
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "ExpireCase"
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, caseId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(caseId))
+	if err != nil {
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+}
+
+func (setup *OrgSetup) SetModeratorSelection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetModeratorSelection"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in changing moderator selection", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in changing moderator selection", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in changing moderator selection", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetModeratorScoring(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetModeratorScoring"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in changing moderator scoring", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in changing moderator scoring", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in changing moderator scoring", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetAppealThreshold(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetAppealThreshold"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in changing appeal threshold", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in changing appeal threshold", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in changing appeal threshold", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) NominateCandidate(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "NominateCandidate"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in nominating candidate", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in nominating candidate", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in nominating candidate", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) CastBallot(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "CastBallot"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in casting ballot", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in casting ballot", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in casting ballot", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) CloseElection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "CloseElection"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in closing election", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in closing election", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in closing election", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) ExpireCase(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "ExpireCase"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in expiring moderation case", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in expiring moderation case", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in expiring moderation case", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetCasePolicy(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetCasePolicy"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in changing case policy", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in changing case policy", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in changing case policy", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) SetCommunityVisibility(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "SetCommunityVisibility"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in changing community visibility", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in changing community visibility", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in changing community visibility", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) RequestToJoin(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "RequestToJoin"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in requesting to join community", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in requesting to join community", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in requesting to join community", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "ApproveJoinRequest"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in approving join request", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in approving join request", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in approving join request", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+func (setup *OrgSetup) RejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "RejectJoinRequest"
+	args := r.Form["args"]
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if err != nil {
+		http.Error(w, "Error in rejecting join request", http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, "Error in rejecting join request", http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, "Error in rejecting join request", http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
+/*
+Saves a post or comment for the logged in user. The item's Id, taken from the itemId form field,
+is passed to the chaincode as transient data so that it isn't recorded on the ledger.
+*/
+func (setup *OrgSetup) SavePost(w http.ResponseWriter, r *http.Request) {
+	setup.submitWithTransient(w, r, "SavePost", "Error in saving item", "itemId")
+}
+
+func (setup *OrgSetup) UnsavePost(w http.ResponseWriter, r *http.Request) {
+	setup.submitWithTransient(w, r, "UnsavePost", "Error in unsaving item", "itemId")
+}
+
+/*
+Sends a message from the logged in user. The recipient ("recipientId"), the body ("body") and a fresh random salt are passed
+to the chaincode as transient data, so the message is kept in the private data collection and never recorded on the ledger.
+*/
+func (setup *OrgSetup) SendMessage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	salt, err := newMessageSalt()
+	if err != nil {
+		http.Error(w, "Error in sending message", http.StatusInternalServerError)
+		fmt.Printf("Error generating message salt: %s", err)
+		return
+	}
+	r.Form.Set("salt", salt)
+	setup.submitWithTransient(w, r, "SendMessage", "Error in sending message", "recipientId", "body", "salt")
+}
+
+/*
+Returns a random hex salt for a direct message. The chaincode publishes the hash of the salt and body,
+so the salt keeps short or predictable messages from being guessed from the ledger.
+*/
+func newMessageSalt() (string, error) {
+	salt := make([]byte, 32)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+/*
+Marks the logged in user's conversation with another user ("recipientId") as read.
+*/
+func (setup *OrgSetup) MarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	setup.submitWithTransient(w, r, "MarkConversationRead", "Error in marking conversation read", "recipientId")
+}
+
+/*
+Submits a transaction that takes the logged in user's Id as its only argument, passing the named form fields as transient data.
+*/
+func (setup *OrgSetup) submitWithTransient(w http.ResponseWriter, r *http.Request, function string, errorMessage string, transientFields ...string) {
+	fmt.Println("Received Invoke request")
+	if err := r.ParseForm(); err != nil {
+		fmt.Fprintf(w, "ParseForm() err: %s", err)
+		return
+	}
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	transient := make(map[string][]byte)
+	for _, field := range transientFields {
+		transient[field] = []byte(r.Form.Get(field))
+	}
+	fmt.Printf("channel: %s, chaincode: %s, function: %s\n", channelID, chainCodeName, function)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(userId), client.WithTransient(transient))
+	if err != nil {
+		http.Error(w, errorMessage, http.StatusInternalServerError)
+		fmt.Printf("Error creating txn proposal: %s", err)
+		return
+	}
+	txn_endorsed, err := txn_proposal.Endorse()
+	if err != nil {
+		http.Error(w, errorMessage, http.StatusInternalServerError)
+		fmt.Printf("Error endorsing txn: %s", err)
+		return
+	}
+	txn_committed, err := txn_endorsed.Submit()
+	if err != nil {
+		http.Error(w, errorMessage, http.StatusInternalServerError)
+		fmt.Printf("Error submitting transaction: %s", err)
+		return
+	}
+	fmt.Println(txn_committed.TransactionID())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", txn_endorsed.Result())
+}
+
 func (setup OrgSetup) Login(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received Query request")
 	//queryParams := r.URL.Query()
@@ -1,10 +1,14 @@
 package web
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 )
 
+const HistoryEntriesPerPage = 20
+
 // Query handles chaincode query requests.
 func (setup OrgSetup) Query(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received Query request")
@@ -34,9 +38,15 @@ func (setup OrgSetup) GetPost(w http.ResponseWriter, r *http.Request) {
 	channelID := "mychannel"
 	function := "GetPostModified"
 	postId := r.URL.Query().Get("id")
-	userId := r.URL.Query().Get("userId")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args:\n", channelID, chainCodeName, function)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	evaluateResponse, err := contract.EvaluateTransaction(function, postId, userId)
@@ -55,9 +65,15 @@ func (setup OrgSetup) GetComment(w http.ResponseWriter, r *http.Request) {
 	channelID := "mychannel"
 	function := "GetCommentModified"
 	commentId := r.URL.Query().Get("id")
-	userId := r.URL.Query().Get("userId")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
 	fmt.Printf("channel: %s, chaincode: %s, function: %s\n", channelID, chainCodeName, function)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
 	evaluateResponse, err := contract.EvaluateTransaction(function, commentId, userId)
@@ -95,13 +111,23 @@ func (setup OrgSetup) GetUserFeed(w http.ResponseWriter, r *http.Request) {
 	chainCodeName := "basic"
 	channelID := "mychannel"
 	function := "GetUserFeed"
-	args := r.URL.Query().Get("id")
-	pageNo := r.URL.Query().Get("pageNo")
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s page: %s\n", channelID, chainCodeName, function, args, pageNo)
-	network := setup.Gateway.GetNetwork(channelID)
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	sortBy := r.URL.Query().Get("sort")   // new (default), hot, top or controversial
+	window := r.URL.Query().Get("window") // day, week, month or all, for top and controversial
+	flair := r.URL.Query().Get("flair")   // flair text, optional
+	feed := r.URL.Query().Get("feed")     // communities (default) or following
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s cursor: %s\n", channelID, chainCodeName, function, userId, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	evaluateResponse, err := contract.EvaluateTransaction(function, args, pageNo)
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, cursor, sortBy, window, flair, feed)
 	if err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		//fmt.Fprintf(w, "%s", err)
@@ -144,13 +170,19 @@ func (setup OrgSetup) GetCommentFeed(w http.ResponseWriter, r *http.Request) {
 	channelID := "mychannel"
 	function := "GetCommentFeed"
 	args := r.URL.Query().Get("parentId")
-	pageNo := r.URL.Query().Get("pageNo")
-	userId := r.URL.Query().Get("userId")
+	cursor := r.URL.Query().Get("cursor")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	evaluateResponse, err := contract.EvaluateTransaction(function, args, pageNo, userId)
+	evaluateResponse, err := contract.EvaluateTransaction(function, args, cursor, userId)
 	if err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		// fmt.Fprintf(w, "%s", err)
@@ -169,13 +201,19 @@ func (setup OrgSetup) GetUserProfilePosts(w http.ResponseWriter, r *http.Request
 	channelID := "mychannel"
 	function := "GetUserProfilePosts"
 	args := r.URL.Query().Get("targetId")
-	userId := r.URL.Query().Get("userId")
-	pageNo := r.URL.Query().Get("pageNo")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, pageNo)
+	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, cursor)
 	if err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		// fmt.Fprintf(w, "%s", err)
@@ -194,13 +232,19 @@ func (setup OrgSetup) GetUserProfileComments(w http.ResponseWriter, r *http.Requ
 	channelID := "mychannel"
 	function := "GetUserProfileComments"
 	args := r.URL.Query().Get("targetId")
-	userId := r.URL.Query().Get("userId")
-	pageNo := r.URL.Query().Get("pageNo")
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s cursor: %s\n", channelID, chainCodeName, function, args, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, pageNo)
+	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, cursor)
 	if err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		// fmt.Fprintf(w, "%s", err)
@@ -219,13 +263,22 @@ func (setup OrgSetup) GetCommunityPosts(w http.ResponseWriter, r *http.Request)
 	channelID := "mychannel"
 	function := "GetCommunityPosts"
 	args := r.URL.Query().Get("communityId")
-	userId := r.URL.Query().Get("userId")
-	pageNo := r.URL.Query().Get("pageNo")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	sortBy := r.URL.Query().Get("sort")   // new (default), hot, top or controversial
+	window := r.URL.Query().Get("window") // day, week, month or all, for top and controversial
+	flair := r.URL.Query().Get("flair")   // flair text, optional
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, pageNo)
+	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, cursor, sortBy, window, flair)
 	if err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		// fmt.Fprintf(w, "%s", err)
@@ -244,13 +297,20 @@ func (setup OrgSetup) GetCommunityAppealed(w http.ResponseWriter, r *http.Reques
 	channelID := "mychannel"
 	function := "GetCommunityAppealed"
 	args := r.URL.Query().Get("communityId")
-	userId := r.URL.Query().Get("userId")
-	pageNo := r.URL.Query().Get("pageNo")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	state := r.URL.Query().Get("state")
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
 	w.Header().Set("Content-Type", "application/json")
-	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, pageNo)
+	evaluateResponse, err := contract.EvaluateTransaction(function, args, userId, cursor, state)
 	if err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		// fmt.Fprintf(w, "%s", err)
@@ -260,3 +320,673 @@ func (setup OrgSetup) GetCommunityAppealed(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "%s", evaluateResponse)
 }
+
+func (setup OrgSetup) GetCommunityFlairs(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetCommunityFlairs"
+	communityId := r.URL.Query().Get("communityId")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetPollResults(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetPollResults"
+	postId := r.URL.Query().Get("id")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, postId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, postId, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+/*
+Returns a page of the logged in user's saved items. The chaincode only lets users read their own saved items,
+so the query is evaluated with the user's identity rather than the service's.
+*/
+func (setup OrgSetup) GetSavedItems(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetSavedItems"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, cursor: %s\n", channelID, chainCodeName, function, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetFollowers"
+	userId := r.URL.Query().Get("id")
+	cursor := r.URL.Query().Get("cursor")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, userId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetFollowing"
+	userId := r.URL.Query().Get("id")
+	cursor := r.URL.Query().Get("cursor")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, userId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetConversations(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetConversations"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, cursor: %s\n", channelID, chainCodeName, function, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetMessages(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetMessages"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	otherUserId := r.URL.Query().Get("with")
+	cursor := r.URL.Query().Get("cursor")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, cursor: %s\n", channelID, chainCodeName, function, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, otherUserId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetUnreadMessageCount(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetUnreadMessageCount"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s\n", channelID, chainCodeName, function)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetNotifications"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	unreadOnly := r.URL.Query().Get("unread") // "true" to skip notifications that have been read
+	if unreadOnly == "" {
+		unreadOnly = "false"
+	}
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, cursor: %s\n", channelID, chainCodeName, function, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId, cursor, unreadOnly)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetUnreadNotificationCount"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s\n", channelID, chainCodeName, function)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetNotificationPreferences"
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s\n", channelID, chainCodeName, function)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetCommunityRules(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetCommunityRules"
+	communityId := r.URL.Query().Get("communityId")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+func (setup OrgSetup) GetRevisionHistory(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetRevisionHistory"
+	itemId := r.URL.Query().Get("id")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s\n", channelID, chainCodeName, function)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, itemId, userId)
+	if err != nil {
+		fmt.Fprintf(w, "%s", err)
+		return
+	}
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+type HistoryPage struct {
+	Entries    []json.RawMessage `json:"entries"`
+	NextCursor string            `json:"nextCursor"`
+}
+
+/*
+Pages through the ledger history of a post, comment, community or user, named by the type and id parameters.
+The chaincode returns the whole key history, so the page is cut out here and the cursor is the offset of the next entry.
+*/
+func (setup OrgSetup) GetItemHistory(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetItemHistory"
+	itemType := r.URL.Query().Get("type") // post, comment, community or user
+	itemId := r.URL.Query().Get("id")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	cursor := r.URL.Query().Get("cursor")
+	start := 0
+	if cursor != "" {
+		var err error
+		start, err = strconv.Atoi(cursor)
+		if err != nil || start < 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s %s cursor: %s\n", channelID, chainCodeName, function, itemType, itemId, cursor)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, itemType, itemId, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	var history []json.RawMessage
+	err = json.Unmarshal(evaluateResponse, &history)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	start = min(start, len(history))
+	end := min(start+HistoryEntriesPerPage, len(history))
+	page := HistoryPage{Entries: history[start:end]}
+	if end < len(history) {
+		page.NextCursor = strconv.Itoa(end)
+	}
+	pageJson, _ := json.Marshal(page)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", pageJson)
+}
+
+/*
+Returns a page of a community's pending join requests. Only moderators can read them, so the query
+is evaluated with the logged in user's identity.
+*/
+func (setup OrgSetup) GetJoinRequests(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetJoinRequests"
+	communityId := r.URL.Query().Get("communityId")
+	cursor := r.URL.Query().Get("cursor")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+/*
+Returns a page of a community's bans. Only moderators can read them, so the query
+is evaluated with the logged in user's identity.
+*/
+func (setup OrgSetup) GetCommunityBans(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetCommunityBans"
+	communityId := r.URL.Query().Get("communityId")
+	cursor := r.URL.Query().Get("cursor")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+/*
+Returns a page of a community's moderation log. Private communities only show their log to members,
+so the query is evaluated with the logged in user's identity.
+*/
+func (setup OrgSetup) GetModLog(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetModLog"
+	communityId := r.URL.Query().Get("communityId")
+	cursor := r.URL.Query().Get("cursor")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+func (setup OrgSetup) GetModeratorScoring(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetModeratorScoring"
+	communityId := r.URL.Query().Get("communityId")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+func (setup OrgSetup) GetModeratorRanking(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetModeratorRanking"
+	communityId := r.URL.Query().Get("communityId")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+func (setup OrgSetup) GetCasePolicy(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetCasePolicy"
+	communityId := r.URL.Query().Get("communityId")
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+func (setup OrgSetup) GetModerationCase(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetModerationCase"
+	caseId := r.URL.Query().Get("caseId")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, caseId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, caseId, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+/*
+Returns a page of a community's elections. Private communities only show their elections to members,
+so the query is evaluated with the logged in user's identity.
+*/
+func (setup OrgSetup) GetCommunityElections(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetCommunityElections"
+	communityId := r.URL.Query().Get("communityId")
+	cursor := r.URL.Query().Get("cursor")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, communityId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, communityId, userId, cursor)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+/*
+Returns an election with its candidates and, once closed, its results. Private communities only show their elections to members,
+so the query is evaluated with the logged in user's identity.
+*/
+func (setup OrgSetup) GetElection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetElection"
+	electionId := r.URL.Query().Get("id")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, electionId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, electionId, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
+
+/*
+Returns the logged in user's ballot in an election. Only voters can read their own ballot,
+so the query is evaluated with the logged in user's identity.
+*/
+func (setup OrgSetup) GetBallot(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Query request")
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	function := "GetBallot"
+	electionId := r.URL.Query().Get("id")
+	userId, _ := r.Context().Value(userIdContextKey).(string)
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, electionId)
+	gateway, err := setup.callerGateway(r)
+	if err != nil {
+		http.Error(w, "Logout and login again", http.StatusUnauthorized)
+		fmt.Printf("Error connecting as caller: %s", err)
+		return
+	}
+	network := gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	w.Header().Set("Content-Type", "application/json")
+	evaluateResponse, err := contract.EvaluateTransaction(function, electionId, userId)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", evaluateResponse)
+}
@@ -0,0 +1,437 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"rest-api/search"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+const SearchResultsPerPage = 20
+
+// How long to wait before reconnecting when the chaincode event stream breaks
+const eventRetryInterval = 5 * time.Second
+
+// searchIndex holds the searchable content of the ledger. It lives in memory and is rebuilt on start
+// by replaying the chaincode events from the first block.
+var searchIndex = search.NewIndex()
+
+// privateCommunities holds the Ids of the private communities. Their posts and comments stay indexed
+// but are left out of search results, since only members can read them.
+var privateCommunities = struct {
+	sync.RWMutex
+	ids map[string]bool
+}{ids: make(map[string]bool)}
+
+// crossPosts maps the Id of an original post to the Ids of its cross-posts, which are indexed with the original's text
+// and so follow it when it is edited, hidden or deleted.
+var crossPosts = struct {
+	sync.Mutex
+	ids map[string][]string
+}{ids: make(map[string][]string)}
+
+// chaincodeEvent mirrors the versioned envelope the chaincode attaches to every transaction.
+type chaincodeEvent struct {
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schemaVersion"`
+	TxID          string          `json:"txId"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type indexedPost struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	Author      string    `json:"author"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Community   string
+	CrossPostOf string `json:"crossPostOf"`
+}
+
+// ledgerPost is a post as GetPost returns it
+type ledgerPost struct {
+	indexedPost
+	Hidden     bool
+	CrossPosts []string `json:"crossPosts"`
+}
+
+type indexedComment struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	Community string
+}
+
+type indexedCommunity struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Creator     string    `json:"creator"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type contentEventPayload struct {
+	ItemId   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+}
+
+type caseEventPayload struct {
+	ItemId  string `json:"itemId"`
+	Outcome string `json:"outcome"`
+}
+
+type visibilityEventPayload struct {
+	CommunityId string `json:"communityId"`
+	Visibility  string `json:"visibility"`
+}
+
+// searchCursor is the last result of a page. Scores change as documents are indexed, so the next page starts after
+// that result wherever it now ranks, or after its former rank once it has been removed.
+type searchCursor struct {
+	Score     float64   `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+	ID        string    `json:"id"`
+}
+
+type SearchPage struct {
+	Results    []search.Result `json:"results"`
+	NextCursor string          `json:"nextCursor"`
+}
+
+/*
+Keeps searchIndex current from the chaincode events. Events are replayed from the first block, so the index
+is complete after a restart, and the stream is resumed from the last processed event if it breaks.
+Content written by InitLedger emits no events and isn't indexed.
+*/
+func (setup OrgSetup) IndexEvents(ctx context.Context) {
+	chainCodeName := "basic"
+	channelID := "mychannel"
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	checkpointer := new(client.InMemoryCheckpointer)
+	for ctx.Err() == nil {
+		events, err := network.ChaincodeEvents(ctx, chainCodeName, client.WithStartBlock(0), client.WithCheckpoint(checkpointer))
+		if err != nil {
+			fmt.Printf("Error reading chaincode events: %s\n", err)
+			time.Sleep(eventRetryInterval)
+			continue
+		}
+		for event := range events {
+			err := indexEvent(contract, event.Payload)
+			if err != nil {
+				fmt.Printf("Error indexing event %s of transaction %s: %s\n", event.EventName, event.TransactionID, err)
+			}
+			checkpointer.CheckpointChaincodeEvent(event)
+		}
+		time.Sleep(eventRetryInterval)
+	}
+}
+
+func indexEvent(contract *client.Contract, eventJson []byte) error {
+	var event chaincodeEvent
+	err := json.Unmarshal(eventJson, &event)
+	if err != nil {
+		return err
+	}
+	switch event.Type {
+	case "PostCreated":
+		var post indexedPost
+		err = json.Unmarshal(event.Payload, &post)
+		if err != nil {
+			return err
+		}
+		indexPost(post)
+	case "PostCrossPosted":
+		var post ledgerPost
+		err = json.Unmarshal(event.Payload, &post)
+		if err != nil {
+			return err
+		}
+		return indexCrossPost(contract, &post)
+	case "CommentCreated":
+		var comment indexedComment
+		err = json.Unmarshal(event.Payload, &comment)
+		if err != nil {
+			return err
+		}
+		indexComment(comment)
+	case "CommunityCreated":
+		var community indexedCommunity
+		err = json.Unmarshal(event.Payload, &community)
+		if err != nil {
+			return err
+		}
+		searchIndex.Put(search.Document{
+			ID:        community.ID,
+			Type:      search.CommunityDocument,
+			Community: community.ID,
+			Author:    community.Creator,
+			Title:     community.Name,
+			Content:   community.Description,
+			CreatedAt: community.CreatedAt,
+		})
+	case "ContentEdited", "ContentShown":
+		var payload contentEventPayload
+		err = json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		return reindexItem(contract, payload)
+	case "ContentDeleted", "ContentHidden":
+		var payload contentEventPayload
+		err = json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		removeItem(payload.ItemId)
+	case "CaseExpired":
+		var payload caseEventPayload
+		err = json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		if payload.Outcome == "hidden" {
+			removeItem(payload.ItemId)
+		}
+	case "CommunityVisibilityChanged":
+		var payload visibilityEventPayload
+		err = json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		privateCommunities.Lock()
+		privateCommunities.ids[payload.CommunityId] = payload.Visibility == "private"
+		privateCommunities.Unlock()
+	}
+	return nil
+}
+
+/*
+Drops the posts and comments of private communities from search results. Private communities themselves can still be found.
+*/
+func readableResults(results []search.Result) []search.Result {
+	privateCommunities.RLock()
+	defer privateCommunities.RUnlock()
+	readable := results[:0]
+	for _, result := range results {
+		if result.Type != search.CommunityDocument && privateCommunities.ids[result.Community] {
+			continue
+		}
+		readable = append(readable, result)
+	}
+	return readable
+}
+
+func indexPost(post indexedPost) {
+	searchIndex.Put(search.Document{
+		ID:        post.ID,
+		Type:      search.PostDocument,
+		Community: post.Community,
+		Author:    post.Author,
+		Title:     post.Title,
+		Content:   post.Content,
+		CreatedAt: post.CreatedAt,
+	})
+}
+
+func indexComment(comment indexedComment) {
+	searchIndex.Put(search.Document{
+		ID:        comment.ID,
+		Type:      search.CommentDocument,
+		Community: comment.Community,
+		Author:    comment.Author,
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+	})
+}
+
+/*
+Removes a post or comment from the index, together with the cross-posts of a post.
+*/
+func removeItem(itemId string) {
+	searchIndex.Remove(itemId)
+	crossPosts.Lock()
+	defer crossPosts.Unlock()
+	for _, crossPostId := range crossPosts.ids[itemId] {
+		searchIndex.Remove(crossPostId)
+	}
+}
+
+func getLedgerPost(contract *client.Contract, postId string) (*ledgerPost, error) {
+	postJson, err := contract.EvaluateTransaction("GetPost", postId)
+	if err != nil {
+		return nil, err
+	}
+	if len(postJson) == 0 {
+		return nil, nil
+	}
+	var post ledgerPost
+	err = json.Unmarshal(postJson, &post)
+	if err != nil {
+		return nil, err
+	}
+	if post.ID == "" {
+		return nil, nil
+	}
+	return &post, nil
+}
+
+/*
+A cross-post has no text of its own: it is indexed as a post of its community that carries the original's title and content.
+It is left out while either the cross-post or the original is hidden.
+*/
+func indexCrossPost(contract *client.Contract, crossPost *ledgerPost) error {
+	crossPosts.Lock()
+	if !slices.Contains(crossPosts.ids[crossPost.CrossPostOf], crossPost.ID) {
+		crossPosts.ids[crossPost.CrossPostOf] = append(crossPosts.ids[crossPost.CrossPostOf], crossPost.ID)
+	}
+	crossPosts.Unlock()
+	if crossPost.Hidden {
+		return nil
+	}
+	originalPost, err := getLedgerPost(contract, crossPost.CrossPostOf)
+	if err != nil || originalPost == nil || originalPost.Hidden {
+		return err
+	}
+	crossPost.Title = originalPost.Title
+	crossPost.Content = originalPost.Content
+	indexPost(crossPost.indexedPost)
+	return nil
+}
+
+/*
+Reads a post's current version from the ledger and indexes it. The cross-posts of an original are reindexed with it.
+*/
+func reindexPost(contract *client.Contract, postId string) error {
+	post, err := getLedgerPost(contract, postId)
+	if err != nil || post == nil {
+		return err
+	}
+	if post.CrossPostOf != "" {
+		return indexCrossPost(contract, post)
+	}
+	if !post.Hidden {
+		indexPost(post.indexedPost)
+	}
+	for _, crossPostId := range post.CrossPosts {
+		err = reindexPost(contract, crossPostId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Edit and show events don't carry the item's text, so its current version is read from the ledger.
+*/
+func reindexItem(contract *client.Contract, payload contentEventPayload) error {
+	if payload.ItemType == search.PostDocument {
+		return reindexPost(contract, payload.ItemId)
+	}
+	commentJson, err := contract.EvaluateTransaction("GetComment", payload.ItemId)
+	if err != nil {
+		return err
+	}
+	var comment struct {
+		indexedComment
+		Hidden bool
+	}
+	err = json.Unmarshal(commentJson, &comment)
+	if err != nil {
+		return err
+	}
+	if !comment.Hidden {
+		indexComment(comment.indexedComment)
+	}
+	return nil
+}
+
+/*
+Searches post titles and content, comment bodies and community names.
+Takes the text in q and optional community, author and type filters; results are ranked best match first.
+The cursor marks the last result of the previous page, so a page picks up after it even when documents were indexed in between.
+*/
+func (setup OrgSetup) Search(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received Search request")
+	query := search.Query{
+		Text:      r.URL.Query().Get("q"),
+		Community: r.URL.Query().Get("community"),
+		Author:    r.URL.Query().Get("author"),
+		Type:      r.URL.Query().Get("type"),
+	}
+	cursor := r.URL.Query().Get("cursor")
+	var after *search.Result
+	if cursor != "" {
+		var err error
+		after, err = parseSearchCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	results := readableResults(searchIndex.Search(query))
+	page := searchPage(results, after, SearchResultsPerPage)
+	pageJson, _ := json.Marshal(page)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", pageJson)
+}
+
+/*
+Returns the page of ranked results that starts after the given result, or the first page when after is nil.
+*/
+func searchPage(results []search.Result, after *search.Result, limit int) SearchPage {
+	start := 0
+	if after != nil {
+		start = slices.IndexFunc(results, func(result search.Result) bool {
+			return result.ID == after.ID
+		}) + 1
+		if start == 0 {
+			start = sort.Search(len(results), func(i int) bool {
+				return after.Precedes(results[i])
+			})
+		}
+	}
+	end := min(start+limit, len(results))
+	page := SearchPage{Results: results[start:end]}
+	if end < len(results) && end > start {
+		page.NextCursor = searchCursorOf(results[end-1])
+	}
+	return page
+}
+
+func searchCursorOf(result search.Result) string {
+	cursorJson, _ := json.Marshal(searchCursor{Score: result.Score, CreatedAt: result.CreatedAt, ID: result.ID})
+	return base64.RawURLEncoding.EncodeToString(cursorJson)
+}
+
+func parseSearchCursor(cursor string) (*search.Result, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded searchCursor
+	err = json.Unmarshal(cursorJson, &decoded)
+	if err != nil {
+		return nil, err
+	}
+	if decoded.ID == "" {
+		return nil, fmt.Errorf("cursor has no result Id")
+	}
+	after := search.Result{Score: decoded.Score}
+	after.ID = decoded.ID
+	after.CreatedAt = decoded.CreatedAt
+	return &after, nil
+}
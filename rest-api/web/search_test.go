@@ -0,0 +1,108 @@
+package web
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"rest-api/search"
+)
+
+func TestSearchPage(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	index := search.NewIndex()
+	for i, id := range []string{"p1", "p2", "p3", "p4", "p5"} {
+		index.Put(search.Document{ID: id, Type: search.PostDocument, Content: "golang", CreatedAt: start.Add(time.Duration(i) * time.Hour)})
+	}
+	query := search.Query{Text: "golang"}
+	first := searchPage(index.Search(query), nil, 2)
+	tests := []struct {
+		name       string
+		insert     []string
+		cursor     string
+		want       []string
+		wantCursor bool
+	}{
+		{"second page", nil, first.NextCursor, []string{"p3", "p2"}, true},
+		{"second page after newer matches were indexed", []string{"p6", "p7"}, first.NextCursor, []string{"p3", "p2"}, true},
+	}
+	if got := pageIds(first); !reflect.DeepEqual(got, []string{"p5", "p4"}) || first.NextCursor == "" {
+		t.Fatalf("first page = %v with cursor %q, want [p5 p4] with a cursor", got, first.NextCursor)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, id := range test.insert {
+				index.Put(search.Document{ID: id, Type: search.PostDocument, Content: "golang", CreatedAt: start.Add(24 * time.Hour)})
+			}
+			after, err := parseSearchCursor(test.cursor)
+			if err != nil {
+				t.Fatalf("parseSearchCursor(%q): %s", test.cursor, err)
+			}
+			page := searchPage(index.Search(query), after, 2)
+			if got := pageIds(page); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("page = %v, want %v", got, test.want)
+			}
+			if (page.NextCursor != "") != test.wantCursor {
+				t.Errorf("next cursor = %q, want one %v", page.NextCursor, test.wantCursor)
+			}
+		})
+	}
+}
+
+func TestSearchPageBounds(t *testing.T) {
+	results := []search.Result{
+		{Document: search.Document{ID: "p1"}, Score: 3},
+		{Document: search.Document{ID: "p2"}, Score: 2},
+		{Document: search.Document{ID: "p3"}, Score: 1},
+	}
+	tests := []struct {
+		name       string
+		results    []search.Result
+		after      *search.Result
+		want       []string
+		wantCursor bool
+	}{
+		{"no results", []search.Result{}, nil, []string{}, false},
+		{"no results after a cursor", []search.Result{}, &results[0], []string{}, false},
+		{"exactly one page", results[:2], nil, []string{"p1", "p2"}, false},
+		{"more than one page", results, nil, []string{"p1", "p2"}, true},
+		{"last page", results, &results[1], []string{"p3"}, false},
+		{"cursor at the last result", results, &results[2], []string{}, false},
+		{"cursor at a removed result", []search.Result{results[0], results[2]}, &results[1], []string{"p3"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := searchPage(test.results, test.after, 2)
+			if got := pageIds(page); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("page = %v, want %v", got, test.want)
+			}
+			if (page.NextCursor != "") != test.wantCursor {
+				t.Errorf("next cursor = %q, want one %v", page.NextCursor, test.wantCursor)
+			}
+		})
+	}
+}
+
+func TestParseSearchCursor(t *testing.T) {
+	result := search.Result{Document: search.Document{ID: "p1", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, Score: 1.25}
+	parsed, err := parseSearchCursor(searchCursorOf(result))
+	if err != nil {
+		t.Fatalf("parseSearchCursor: %s", err)
+	}
+	if parsed.ID != result.ID || parsed.Score != result.Score || !parsed.CreatedAt.Equal(result.CreatedAt) {
+		t.Errorf("parsed cursor = %+v, want %+v", parsed, result)
+	}
+	for _, cursor := range []string{"2", "not a cursor!", "e30"} {
+		if _, err := parseSearchCursor(cursor); err == nil {
+			t.Errorf("parseSearchCursor(%q) accepted an invalid cursor", cursor)
+		}
+	}
+}
+
+func pageIds(page SearchPage) []string {
+	ids := make([]string, 0, len(page.Results))
+	for _, result := range page.Results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}